@@ -0,0 +1,216 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// defaultRedactEnv matches the names of environment variables
+// that commonly hold secrets, and are redacted even without -redact-env
+const defaultRedactEnv = `(?i)(token|secret|passw(or)?d|credential|auth|api_?key|private_?key)`
+
+// redactedText replaces redacted values
+const redactedText = "[REDACTED]"
+
+// redactor removes the values of secret environment variables from text
+type redactor struct {
+	patterns []*regexp.Regexp
+	replacer *strings.Replacer
+}
+
+// newRedactor returns a redactor that redacts the values of the variables in env
+// whose name matches any of patterns
+func newRedactor(patterns []*regexp.Regexp, env []string) *redactor {
+	r := &redactor{patterns: patterns}
+	var values []string
+	for _, kv := range env {
+		name, value, _ := strings.Cut(kv, "=")
+		// very short values would redact unrelated text all over the place
+		if len(value) < 4 || !r.secret(name) {
+			continue
+		}
+		values = append(values, value)
+	}
+	// replace longer values first, in case one contains another
+	sort.Slice(values, func(i, j int) bool {
+		return len(values[i]) > len(values[j])
+	})
+	var pairs []string
+	for _, v := range values {
+		pairs = append(pairs, v, redactedText)
+	}
+	r.replacer = strings.NewReplacer(pairs...)
+	return r
+}
+
+// secret reports whether the variable with the given name is to be redacted
+func (r *redactor) secret(name string) bool {
+	for _, ptrn := range r.patterns {
+		if ptrn.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// redact returns s with secret values replaced
+func (r *redactor) redact(s string) string {
+	return r.replacer.Replace(s)
+}
+
+// redactEnv returns env with the values of secret variables replaced
+func (r *redactor) redactEnv(env []string) []string {
+	out := make([]string, len(env))
+	for i, kv := range env {
+		name, value, _ := strings.Cut(kv, "=")
+		if r.secret(name) {
+			value = redactedText
+		} else {
+			value = r.redact(value)
+		}
+		out[i] = name + "=" + value
+	}
+	return out
+}
+
+// defaultArtifactName is the default -artifact-name, which names the artifact dir of a target after its path
+const defaultArtifactName = "{{.Target}}"
+
+// artifactStore saves the output, environment and corpus of each target
+// under dir, in a dir named by the name template, which is path/to/package/FuzzFuncName by default
+type artifactStore struct {
+	dir      string
+	name     *template.Template
+	redactor *redactor
+	// secrets is the policy for artifacts that contain possible secrets
+	secrets string
+	// run and date are the id of the run and when it started, for the name template
+	run  string
+	date time.Time
+}
+
+// artifactNameData is what -artifact-name templates can refer to
+type artifactNameData struct {
+	Pkg    string
+	Func   string
+	Target string
+	Status string
+	Run    string
+	// Date and Time are when the run started, as in 2006-01-02 and 150405
+	Date string
+	Time string
+	// Signature identifies the failure of the target, if it failed; see failureSignature
+	Signature string
+}
+
+// parseArtifactName parses an -artifact-name template, and checks that it names a dir under the artifacts dir
+func parseArtifactName(s string) (*template.Template, error) {
+	tmpl, err := template.New("").Funcs(templateFuncs).Option("missingkey=error").Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	a := artifactStore{name: tmpl, date: time.Now()}
+	_, err = a.targetDir(result{fuzz: fuzz{pkg: "pkg", fn: "FuzzFunc", fullpath: "pkg/FuzzFunc"}})
+	if err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// targetDir returns the artifact dir of the target of r
+func (a artifactStore) targetDir(r result) (string, error) {
+	if a.name == nil {
+		return filepath.Join(a.dir, filepath.FromSlash(r.fullpath)), nil
+	}
+	var b strings.Builder
+	err := a.name.Execute(&b, artifactNameData{
+		Pkg:       r.pkg,
+		Func:      r.fn,
+		Target:    r.fullpath,
+		Status:    r.status(),
+		Run:       a.run,
+		Date:      a.date.Format("2006-01-02"),
+		Time:      a.date.Format("150405"),
+		Signature: failureSignature(r.output),
+	})
+	if err != nil {
+		return "", fmt.Errorf("could not name the artifact dir of %s: %w", r.fullpath, err)
+	}
+	name := filepath.FromSlash(b.String())
+	if !filepath.IsLocal(name) {
+		return "", fmt.Errorf(`the artifact dir name "%s" of %s is not a relative path without ".."`, b.String(), r.fullpath)
+	}
+	return filepath.Join(a.dir, name), nil
+}
+
+// save writes the artifacts of r
+func (a artifactStore) save(r result) error {
+	dir, err := a.targetDir(r)
+	if err != nil {
+		return err
+	}
+	files := map[string]string{
+		"output.log": a.redactor.redact(r.output),
+		"env.txt":    strings.Join(a.redactor.redactEnv(r.env), "\n") + "\n",
+	}
+
+	// include the target's corpus, which contains any failing inputs
+	corpusDir := filepath.Join(filepath.FromSlash(r.pkg), "testdata", "fuzz", r.fn)
+	entries, err := os.ReadDir(corpusDir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf(`could not read corpus dir "%s": %w`, corpusDir, err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		p := filepath.Join(corpusDir, entry.Name())
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return fmt.Errorf(`could not read corpus entry "%s": %w`, p, err)
+		}
+		files[filepath.Join("corpus", entry.Name())] = string(data)
+	}
+
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		content, ok := a.scan(p, content)
+		if !ok {
+			continue
+		}
+		err := os.MkdirAll(filepath.Dir(p), 0o755)
+		if err != nil {
+			return fmt.Errorf(`could not create artifact dir "%s": %w`, filepath.Dir(p), err)
+		}
+		err = os.WriteFile(p, []byte(content), 0o644)
+		if err != nil {
+			return fmt.Errorf(`could not write artifact "%s": %w`, p, err)
+		}
+	}
+	return nil
+}
+
+// scan applies the secret scanning policy to the content of the artifact at p.
+// it returns the content to save, and whether the artifact is to be saved at all.
+func (a artifactStore) scan(p string, content string) (string, bool) {
+	if a.secrets == "" || a.secrets == secretsOff {
+		return content, true
+	}
+	redacted, found := redactSecrets(content)
+	if !found {
+		return content, true
+	}
+	if a.secrets == secretsBlock {
+		logger.Warn("not saving artifact, as it contains possible secrets", "path", p)
+		return "", false
+	}
+	return redacted, true
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// cgroupRoot is where the cgroup filesystems are mounted
+const cgroupRoot = "/sys/fs/cgroup"
+
+// cgroupCPUQuota returns the number of cpus' worth of cpu time that the cgroup cpu quota
+// of this process allows, as in a container limited to 2 cpus, or zero if there's no quota.
+// both cgroup v2 and the cpu controller of cgroup v1 are supported.
+func cgroupCPUQuota() float64 {
+	data, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return 0
+	}
+	sc := bufio.NewScanner(strings.NewReader(string(data)))
+	for sc.Scan() {
+		// lines are HIERARCHY-ID:CONTROLLERS:PATH, with empty controllers for cgroup v2
+		fields := strings.SplitN(sc.Text(), ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		switch {
+		case fields[0] == "0" && fields[1] == "":
+			if quota := cgroup2CPUQuota(fields[2]); quota > 0 {
+				return quota
+			}
+		case containsController(fields[1], "cpu"):
+			if quota := cgroup1CPUQuota(fields[2]); quota > 0 {
+				return quota
+			}
+		}
+	}
+	return 0
+}
+
+// cgroup2CPUQuota returns the cpu quota of the cgroup v2 group at path, or of its closest limited ancestor.
+// in a container, the group usually appears as the root, and path doesn't exist, so the root is tried too.
+func cgroup2CPUQuota(path string) float64 {
+	for dir := filepath.Join(cgroupRoot, path); ; dir = filepath.Dir(dir) {
+		data, err := os.ReadFile(filepath.Join(dir, "cpu.max"))
+		if err == nil {
+			// cpu.max is "QUOTA PERIOD", with a QUOTA of "max" for no limit
+			fields := strings.Fields(string(data))
+			if len(fields) == 2 && fields[0] != "max" {
+				if quota := cpuRatio(fields[0], fields[1]); quota > 0 {
+					return quota
+				}
+			}
+		}
+		if dir == cgroupRoot || !strings.HasPrefix(dir, cgroupRoot) {
+			return 0
+		}
+	}
+}
+
+// cgroup1CPUQuota returns the cpu quota of the cgroup v1 group at path of the cpu controller
+func cgroup1CPUQuota(path string) float64 {
+	for _, mount := range []string{"cpu", "cpu,cpuacct", "cpuacct,cpu"} {
+		for _, dir := range []string{filepath.Join(cgroupRoot, mount, path), filepath.Join(cgroupRoot, mount)} {
+			quota, err := os.ReadFile(filepath.Join(dir, "cpu.cfs_quota_us"))
+			if err != nil {
+				continue
+			}
+			period, err := os.ReadFile(filepath.Join(dir, "cpu.cfs_period_us"))
+			if err != nil {
+				continue
+			}
+			// a quota of -1 means no limit, which cpuRatio reports as zero
+			return cpuRatio(strings.TrimSpace(string(quota)), strings.TrimSpace(string(period)))
+		}
+	}
+	return 0
+}
+
+// cpuRatio returns quota/period of cpu time, or zero if they aren't positive numbers
+func cpuRatio(quota string, period string) float64 {
+	q, err := strconv.ParseFloat(quota, 64)
+	if err != nil || q <= 0 {
+		return 0
+	}
+	p, err := strconv.ParseFloat(period, 64)
+	if err != nil || p <= 0 {
+		return 0
+	}
+	return q / p
+}
+
+// containsController reports whether the comma-separated cgroup v1 controllers list has c
+func containsController(controllers string, c string) bool {
+	for _, s := range strings.Split(controllers, ",") {
+		if s == c {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package main
+
+// cgroupCPUQuota returns zero, as there are no cgroups on this platform
+func cgroupCPUQuota() float64 {
+	return 0
+}
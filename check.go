@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+)
+
+const checkHelpText = `Usage: gofuzz check [OPTIONS...]
+
+check looks for fuzz targets that are likely to fuzz poorly, and reports them.
+these are the targets without seeds, which have neither f.Add calls nor
+seed corpus entries in testdata/fuzz, so that the fuzzer starts from nothing.
+check only fails because of them with -fail-no-seeds.
+
+Options:
+`
+
+// checkCmd implements the check subcommand
+func checkCmd(args []string) {
+	flags := flag.NewFlagSet("check", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, checkHelpText)
+		flags.PrintDefaults()
+	}
+	root := flags.String("root", ".", "root dir of the go project")
+	matchPtrn := flags.String("match", ".", "only check functions where this regexp matches against path/to/package/FuzzFuncName")
+	workspace := flags.Bool("workspace", false, "descend into nested modules; use with a go.work file that includes them")
+	followSymlinks := flags.Bool("follow-symlinks", false, "descend into symlinked dirs when looking for fuzz functions")
+	failNoSeeds := flags.Bool("fail-no-seeds", false, "fail if any target has no seeds")
+	flags.Parse(args)
+	matchRgx, err := regexp.Compile(*matchPtrn)
+	if err != nil {
+		die(fmt.Errorf("the -match regexp is invalid: %w", err))
+	}
+	err = os.Chdir(*root)
+	if err != nil {
+		die(fmt.Errorf(`could not change directory to "%s": %w`, *root, err))
+	}
+	fuzzChan := make(chan fuzz, 1024)
+	go func() {
+		defer close(fuzzChan)
+		opts := walkOptions{followSymlinks: *followSymlinks, workspace: *workspace}
+		err := discover(matchRgx, opts, loadDiscoveryCache(), fuzzChan)
+		if err != nil {
+			die(fmt.Errorf("could not walk dir: %w", err))
+		}
+	}()
+	total, seedless := 0, 0
+	for f := range dedupTargets(fuzzChan) {
+		total++
+		if len(f.seeds) > 0 || corpusEntries(f) > 0 {
+			continue
+		}
+		seedless++
+		fmt.Printf("%s:%d: %s has no seeds: add some with f.Add or to %s\n", f.file, f.line, f.fullpath, seedDir(f))
+	}
+	fmt.Fprintf(os.Stderr, "checked %d targets, %d without seeds\n", total, seedless)
+	if *failNoSeeds && seedless > 0 {
+		os.Exit(1)
+	}
+}
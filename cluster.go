@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// failureCluster is a group of targets whose failures panicked in the same function,
+// such as a library function that they all call, so they likely hit the same bug
+type failureCluster struct {
+	Frame   string   `json:"frame"`
+	Targets []string `json:"targets"`
+}
+
+// clusterFailures groups the failed results by the function that panicked, the largest groups first.
+// failures that didn't panic aren't grouped.
+func clusterFailures(failed []result) []failureCluster {
+	byFrame := make(map[string][]string)
+	for _, r := range failed {
+		frame := crashFrame(r.output)
+		if frame == "" {
+			continue
+		}
+		byFrame[frame] = append(byFrame[frame], r.fullpath)
+	}
+	clusters := make([]failureCluster, 0, len(byFrame))
+	for frame, targets := range byFrame {
+		sort.Strings(targets)
+		clusters = append(clusters, failureCluster{Frame: frame, Targets: targets})
+	}
+	sort.Slice(clusters, func(i, j int) bool {
+		if len(clusters[i].Targets) != len(clusters[j].Targets) {
+			return len(clusters[i].Targets) > len(clusters[j].Targets)
+		}
+		return clusters[i].Frame < clusters[j].Frame
+	})
+	return clusters
+}
+
+// hits returns how many targets hit the bug of the cluster, in words
+func (c failureCluster) hits() string {
+	if len(c.Targets) == 1 {
+		return "1 bug hit by 1 target"
+	}
+	return fmt.Sprintf("1 bug hit by %d targets", len(c.Targets))
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ansi color codes of the console output
+const (
+	colorRed    = "31"
+	colorGreen  = "32"
+	colorYellow = "33"
+	colorBold   = "1"
+)
+
+// useColor decides whether output to f is colored, according to a -color mode
+// of auto, always or never. auto colors terminals, unless NO_COLOR is set
+// or TERM is dumb.
+func useColor(mode string, f *os.File) (bool, error) {
+	switch mode {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "auto":
+		if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+			return false, nil
+		}
+		info, err := f.Stat()
+		return err == nil && info.Mode()&os.ModeCharDevice != 0, nil
+	}
+	return false, fmt.Errorf(`invalid -color value "%s"`, mode)
+}
+
+// paint wraps s in the given ansi color codes
+func paint(s string, codes ...string) string {
+	return "\x1b[" + strings.Join(codes, ";") + "m" + s + "\x1b[0m"
+}
+
+// statusColor returns the color of the given status of a target
+func statusColor(status string) string {
+	switch status {
+	case "pass":
+		return colorGreen
+	case "fail", "broken":
+		return colorRed
+	}
+	return colorYellow
+}
+
+// highlightPanics makes the panic lines of output stand out
+func highlightPanics(output string) string {
+	lines := strings.Split(output, "\n")
+	for i, line := range lines {
+		if strings.Contains(line, "panic: ") {
+			lines[i] = paint(line, colorBold, colorRed)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// argsWordRgx matches a template word that consists of nothing but {{.Args}}
+var argsWordRgx = regexp.MustCompile(`^\{\{-?\s*\.Args\s*-?\}\}$`)
+
+// commandData is what the words of a command template are executed with
+type commandData struct {
+	// Args are the go test args: the package, -run, -fuzz, GOTESTARGS and so on
+	Args []string
+	// Pkg is the package, as in ./path/to/package
+	Pkg string
+	// Func is the name of the fuzz function
+	Func string
+	// Target is the path of the target, as in path/to/package/FuzzFuncName
+	Target string
+}
+
+// commandWord is a word of a command template
+type commandWord struct {
+	// args makes the word expand to all of the go test args, as separate args
+	args bool
+	// tmpl, if non-nil, is executed to produce the word
+	tmpl *template.Template
+	// lit is the word itself, if neither of the above apply
+	lit string
+}
+
+// commandTemplate is a command line, split into words, that runs go test
+type commandTemplate []commandWord
+
+// templateFuncs are the functions available to command templates
+var templateFuncs = template.FuncMap{
+	"join": strings.Join,
+}
+
+// literalCommand returns a template that runs the command given as args,
+// with the go test args appended to it
+func literalCommand(args []string) commandTemplate {
+	var c commandTemplate
+	for _, arg := range args {
+		c = append(c, commandWord{lit: arg})
+	}
+	return append(c, commandWord{args: true})
+}
+
+// parseCommandTemplate parses a command template.
+// the template is split into words at whitespace outside of template actions,
+// and each word is a text/template executed with commandData.
+// a word that is just {{.Args}} expands to the go test args as separate args,
+// so args that contain spaces survive intact.
+func parseCommandTemplate(s string) (commandTemplate, error) {
+	words, err := splitCommand(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(words) == 0 {
+		return nil, errors.New("empty command")
+	}
+	var c commandTemplate
+	for _, word := range words {
+		if argsWordRgx.MatchString(word) {
+			c = append(c, commandWord{args: true})
+			continue
+		}
+		if !strings.Contains(word, "{{") {
+			c = append(c, commandWord{lit: word})
+			continue
+		}
+		tmpl, err := template.New("").Funcs(templateFuncs).Option("missingkey=error").Parse(word)
+		if err != nil {
+			return nil, err
+		}
+		c = append(c, commandWord{tmpl: tmpl})
+	}
+	return c, nil
+}
+
+// splitCommand splits s into words using shell-like rules:
+// words are separated by whitespace, single quotes preserve everything inside them,
+// double quotes preserve everything but backslash escapes of \, ", $ and `,
+// and a backslash outside of quotes preserves the next character.
+// text inside of {{ and }} is kept verbatim, so that template actions
+// may contain whitespace and quoted strings. single quotes keep {{ from starting an action,
+// so that commands such as sh -c 'echo {{' split as the shell would split them.
+// splitting only removes the quotes, though: parseCommandTemplate still parses
+// every word that contains {{ as a template, quoted or not.
+func splitCommand(s string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord, depth := false, 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case depth > 0:
+			if strings.HasPrefix(s[i:], "}}") {
+				depth--
+				word.WriteString("}}")
+				i++
+			} else {
+				word.WriteByte(c)
+			}
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			} else {
+				word.WriteByte(c)
+			}
+		case strings.HasPrefix(s[i:], "{{"):
+			depth++
+			word.WriteString("{{")
+			inWord = true
+			i++
+		case quote == '"':
+			if c == '"' {
+				quote = 0
+			} else if c == '\\' && i+1 < len(s) && strings.IndexByte("\\\"$`", s[i+1]) >= 0 {
+				i++
+				word.WriteByte(s[i])
+			} else {
+				word.WriteByte(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inWord = true
+		case c == '\\':
+			if i+1 == len(s) {
+				return nil, errors.New("trailing backslash")
+			}
+			i++
+			word.WriteByte(s[i])
+			inWord = true
+		case unicode.IsSpace(rune(c)):
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	if depth > 0 {
+		return nil, errors.New("unterminated template action")
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// expand returns the command line for the given data
+func (c commandTemplate) expand(data commandData) ([]string, error) {
+	var args []string
+	for _, word := range c {
+		switch {
+		case word.args:
+			args = append(args, data.Args...)
+		case word.tmpl != nil:
+			var sb strings.Builder
+			err := word.tmpl.Execute(&sb, data)
+			if err != nil {
+				return nil, fmt.Errorf("could not execute command template: %w", err)
+			}
+			args = append(args, sb.String())
+		default:
+			args = append(args, word.lit)
+		}
+	}
+	if len(args) == 0 {
+		return nil, errors.New("command template expanded to nothing")
+	}
+	return args, nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{`a b  c`, []string{"a", "b", "c"}},
+		{`a 'b c' "d e"`, []string{"a", "b c", "d e"}},
+		{`a "b \"c\" \d"`, []string{"a", `b "c" \d`}},
+		{`a\ b`, []string{"a b"}},
+		{`sh -c 'echo {{' x`, []string{"sh", "-c", "echo {{", "x"}},
+		{`echo '{{x}}'`, []string{"echo", "{{x}}"}},
+		{`echo {{printf "%s %s" .Pkg .Func}} x`, []string{"echo", `{{printf "%s %s" .Pkg .Func}}`, "x"}},
+		{`echo "{{.Func}} x"`, []string{"echo", "{{.Func}} x"}},
+	}
+	for _, tt := range tests {
+		got, err := splitCommand(tt.in)
+		if err != nil {
+			t.Errorf("splitCommand(%q): %v", tt.in, err)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("splitCommand(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+	for _, in := range []string{`a 'b`, `a "b`, `a \`, `a {{b`} {
+		if _, err := splitCommand(in); err == nil {
+			t.Errorf("splitCommand(%q) didn't fail", in)
+		}
+	}
+}
+
+// a single quoted word is still a template in a command template
+func TestParseCommandTemplateQuoted(t *testing.T) {
+	c, err := parseCommandTemplate(`echo '{{.Func}}' {{.Args}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := c.expand(commandData{Args: []string{"-run", "^$"}, Func: "FuzzX"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"echo", "FuzzX", "-run", "^$"}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	_, err = parseCommandTemplate(`echo '{{x}}'`)
+	if err == nil {
+		t.Error(`'{{x}}' wasn't parsed as a template`)
+	}
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// sizeUnits are the suffixes that parseSize accepts
+var sizeUnits = []struct {
+	suffix string
+	n      int64
+}{
+	{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30},
+	{"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9},
+	{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30},
+	{"B", 1},
+}
+
+// parseSize parses a size in bytes, such as 512K or 10MiB
+func parseSize(s string) (int64, error) {
+	mult := int64(1)
+	num := s
+	for _, u := range sizeUnits {
+		if rest, ok := strings.CutSuffix(s, u.suffix); ok {
+			num, mult = rest, u.n
+			break
+		}
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(num), 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf(`invalid size "%s"`, s)
+	}
+	return n * mult, nil
+}
+
+// corpusStore manages the corpus entries of targets
+// that live outside of their testdata dir
+type corpusStore struct {
+	// cacheDir is the fuzz cache, as in GOCACHE/fuzz,
+	// or the temporary one of -fresh-corpus
+	cacheDir string
+	// fresh is set if cacheDir is the temporary one of -fresh-corpus,
+	// which is organized by package dir rather than by import path
+	fresh bool
+	// limit is the max total size of the seed corpus of a target
+	limit int64
+	// overflow is where the entries beyond limit are moved to
+	overflow string
+	// external are corpus dirs outside of the repo
+	external []string
+}
+
+// goCacheDir returns the fuzz cache dir of the go command
+func goCacheDir() (string, error) {
+	out, err := exec.Command("go", "env", "GOCACHE").Output()
+	if err != nil {
+		return "", fmt.Errorf("could not get GOCACHE: %w", err)
+	}
+	dir := strings.TrimSpace(string(out))
+	if dir == "" || dir == "off" {
+		return "", errors.New("GOCACHE is not set")
+	}
+	return filepath.Join(dir, "fuzz"), nil
+}
+
+// importPathOf returns the import path of the package in the given dir,
+// according to the go.mod of the nearest module it belongs to
+func importPathOf(pkg string) (string, error) {
+	dir := pkg
+	for {
+		if modPath := readModulePath(filepath.FromSlash(dir)); modPath != "" {
+			rel := strings.TrimPrefix(strings.TrimPrefix(pkg, dir), "/")
+			return path.Join(modPath, rel), nil
+		}
+		if dir == "." {
+			return "", fmt.Errorf(`no module found for package "%s"`, pkg)
+		}
+		dir = path.Dir(dir)
+	}
+}
+
+// cacheFor returns the fuzz cache dir of f
+func (c corpusStore) cacheFor(f fuzz) (string, error) {
+	if c.fresh {
+		return filepath.Join(c.cacheDir, filepath.FromSlash(f.pkg), f.fn), nil
+	}
+	importPath, err := importPathOf(f.pkg)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(c.cacheDir, filepath.FromSlash(importPath), f.fn), nil
+}
+
+// seedDir returns the seed corpus dir of f
+func seedDir(f fuzz) string {
+	return filepath.Join(filepath.FromSlash(f.pkg), "testdata", "fuzz", f.fn)
+}
+
+// corpusEntries returns the number of entries in the seed corpus dir of f
+func corpusEntries(f fuzz) int {
+	entries, err := os.ReadDir(seedDir(f))
+	if err != nil {
+		return 0
+	}
+	n := 0
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			n++
+		}
+	}
+	return n
+}
+
+// overflowFor returns the overflow dir of f
+func (c corpusStore) overflowFor(f fuzz) string {
+	return filepath.Join(c.overflow, filepath.FromSlash(f.fullpath))
+}
+
+// prepare moves the seed corpus entries of f beyond the size limit to the overflow dir,
+// and copies the overflow entries and those of the external corpus dirs
+// into the fuzz cache, so that they are used without being in testdata
+func (c corpusStore) prepare(f fuzz) error {
+	if c.overflow == "" && len(c.external) == 0 {
+		return nil
+	}
+	var srcs []string
+	if c.overflow != "" {
+		moved, err := c.shrink(f)
+		if err != nil {
+			return err
+		}
+		if moved > 0 {
+			logger.Info("moved seed corpus entries to the overflow dir", "target", f.fullpath, "entries", moved, "dir", c.overflowFor(f))
+		}
+		srcs = append(srcs, c.overflowFor(f))
+	}
+	for _, dir := range c.external {
+		srcs = append(srcs, filepath.Join(dir, filepath.FromSlash(f.fullpath)))
+	}
+	cache, err := c.cacheFor(f)
+	if err != nil {
+		return err
+	}
+	for _, src := range srcs {
+		_, err = copyCorpus(src, cache)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// shrink moves seed corpus entries of f to the overflow dir
+// until the seed corpus is no larger than the limit.
+// the smallest entries are kept, as they are the most likely
+// to be minimized failing inputs that are worth keeping in the repo.
+func (c corpusStore) shrink(f fuzz) (int, error) {
+	dir := seedDir(f)
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf(`could not read corpus dir "%s": %w`, dir, err)
+	}
+	type entry struct {
+		name string
+		size int64
+	}
+	var files []entry
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return 0, fmt.Errorf(`could not stat corpus entry "%s": %w`, e.Name(), err)
+		}
+		files = append(files, entry{e.Name(), info.Size()})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].size != files[j].size {
+			return files[i].size < files[j].size
+		}
+		return files[i].name < files[j].name
+	})
+	var total int64
+	moved := 0
+	for _, e := range files {
+		total += e.size
+		if total <= c.limit {
+			continue
+		}
+		dst := filepath.Join(c.overflowFor(f), e.name)
+		err := moveFile(filepath.Join(dir, e.name), dst)
+		if err != nil {
+			return moved, err
+		}
+		moved++
+	}
+	return moved, nil
+}
+
+// moveFile moves the file at src to dst, even across file systems
+func moveFile(src, dst string) error {
+	err := os.MkdirAll(filepath.Dir(dst), 0o755)
+	if err != nil {
+		return fmt.Errorf(`could not create dir "%s": %w`, filepath.Dir(dst), err)
+	}
+	if os.Rename(src, dst) == nil {
+		return nil
+	}
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return fmt.Errorf(`could not read "%s": %w`, src, err)
+	}
+	err = os.WriteFile(dst, data, 0o644)
+	if err != nil {
+		return fmt.Errorf(`could not write "%s": %w`, dst, err)
+	}
+	return os.Remove(src)
+}
+
+// corpusHeader is the first line of corpus entries in the go test format
+const corpusHeader = "go test fuzz v1\n"
+
+// copyCorpus copies the corpus entries in src that dst doesn't have yet into dst.
+// entries that aren't in the go test format, such as those of libFuzzer corpora,
+// are taken to be raw inputs of targets that take a single []byte, and are converted.
+// a missing src is treated as empty.
+func copyCorpus(src, dst string) (int, error) {
+	entries, err := os.ReadDir(src)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf(`could not read corpus dir "%s": %w`, src, err)
+	}
+	err = os.MkdirAll(dst, 0o755)
+	if err != nil {
+		return 0, fmt.Errorf(`could not create corpus dir "%s": %w`, dst, err)
+	}
+	n := 0
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		p := filepath.Join(dst, e.Name())
+		if _, err := os.Stat(p); err == nil {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(src, e.Name()))
+		if err != nil {
+			return n, fmt.Errorf(`could not read corpus entry "%s": %w`, e.Name(), err)
+		}
+		if !bytes.HasPrefix(data, []byte(corpusHeader)) {
+			data = []byte(corpusHeader + "[]byte(" + strconv.Quote(string(data)) + ")\n")
+		}
+		err = os.WriteFile(p, data, 0o644)
+		if err != nil {
+			return n, fmt.Errorf(`could not write corpus entry "%s": %w`, p, err)
+		}
+		n++
+	}
+	return n, nil
+}
@@ -0,0 +1,516 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"math"
+	"math/big"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const corpusHelpText = `Usage: gofuzz corpus merge [OPTIONS...] SRC...
+       gofuzz corpus dedup [OPTIONS...]
+       gofuzz corpus stats [OPTIONS...]
+
+merge copies the seed corpus entries of the targets of the project from
+the SRC dirs into their testdata/fuzz dirs. a SRC may be another checkout
+of the project, whose entries are found in its testdata/fuzz dirs, or a
+fuzz cache, such as $(go env GOCACHE)/fuzz, or a GOCACHE itself, whose
+entries are found by the import paths of the packages of the targets.
+entries are named after the hash of their content, as go names them, and
+those whose content the target already has are left out, as are those that
+aren't valid corpus files in the go test fuzz v1 format.
+
+dedup removes the redundant corpus entries of the targets, which are those
+that are byte-identical to another of their entries, or that decode to the
+same values as another, such as int(16) and int(0x10), whether in their
+testdata/fuzz dir or in the fuzz cache of go. entries in testdata are kept
+over those in the cache, and the first entry by name over the others.
+
+stats prints the number of corpus entries of each target, in testdata/fuzz
+and in the fuzz cache, their size, the ages of those in testdata, and the
+types of their values, so that empty, bloated or inconsistent corpora stand
+out, followed by the age distribution of all the entries in testdata.
+
+Options:
+`
+
+// corpusCmd implements the corpus subcommand
+func corpusCmd(args []string) {
+	flags := flag.NewFlagSet("corpus", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, corpusHelpText)
+		flags.PrintDefaults()
+	}
+	root := flags.String("root", ".", "root dir of the go project")
+	matchPtrn := flags.String("match", ".", "only handle the corpora of functions where this regexp matches against path/to/package/FuzzFuncName")
+	workspace := flags.Bool("workspace", false, "descend into nested modules; use with a go.work file that includes them")
+	followSymlinks := flags.Bool("follow-symlinks", false, "descend into symlinked dirs when looking for fuzz functions")
+	dryRun := flags.Bool("dry-run", false, "with dedup, only print the entries that would be removed")
+	largeStr := flags.String("large", "1MiB", "with stats, mark the seed corpora larger than this as large")
+	if len(args) == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	sub := args[0]
+	flags.Parse(args[1:])
+	matchRgx, err := regexp.Compile(*matchPtrn)
+	if err != nil {
+		die(fmt.Errorf("the -match regexp is invalid: %w", err))
+	}
+	// make the srcs absolute, as they are relative to the original working dir
+	srcs := make([]string, flags.NArg())
+	for i, src := range flags.Args() {
+		srcs[i], err = filepath.Abs(src)
+		if err != nil {
+			die(err)
+		}
+	}
+	err = os.Chdir(*root)
+	if err != nil {
+		die(fmt.Errorf(`could not change directory to "%s": %w`, *root, err))
+	}
+	opts := walkOptions{followSymlinks: *followSymlinks, workspace: *workspace}
+	switch sub {
+	case "merge":
+		if len(srcs) == 0 {
+			die("no SRC dirs given.")
+		}
+		mergeCorpora(corpusTargets(matchRgx, opts), srcs)
+	case "dedup":
+		if len(srcs) > 0 {
+			die("dedup takes no args.")
+		}
+		cache := corpusStore{}
+		cache.cacheDir, err = goCacheDir()
+		if err != nil {
+			logger.Warn("only deduplicating the seed corpora, as the fuzz cache can't be found", "err", err)
+		}
+		dedupCorpora(corpusTargets(matchRgx, opts), cache, *dryRun)
+	case "stats":
+		if len(srcs) > 0 {
+			die("stats takes no args.")
+		}
+		large, err := parseSize(*largeStr)
+		if err != nil {
+			die(fmt.Errorf("invalid -large: %w", err))
+		}
+		cache := corpusStore{}
+		cache.cacheDir, err = goCacheDir()
+		if err != nil {
+			logger.Warn("leaving out the fuzz cache, as it can't be found", "err", err)
+		}
+		now := time.Now()
+		var stats []corpusStats
+		for _, f := range corpusTargets(matchRgx, opts) {
+			dir := ""
+			if cache.cacheDir != "" {
+				dir, _ = cache.cacheFor(f)
+			}
+			s, err := readCorpusStats(f, dir, now)
+			if err != nil {
+				die(err)
+			}
+			stats = append(stats, s)
+		}
+		printCorpusStats(os.Stdout, stats, large)
+	default:
+		flags.Usage()
+		os.Exit(2)
+	}
+	finalizers.run()
+}
+
+// corpusTargets returns the targets of the project that matchRgx matches
+func corpusTargets(matchRgx *regexp.Regexp, opts walkOptions) []fuzz {
+	fuzzChan := make(chan fuzz, 1024)
+	go func() {
+		defer close(fuzzChan)
+		err := discover(matchRgx, opts, loadDiscoveryCache(), fuzzChan)
+		if err != nil {
+			die(fmt.Errorf("could not walk dir: %w", err))
+		}
+	}()
+	return collect(dedupTargets(fuzzChan))
+}
+
+// mergeCorpora merges the corpus entries of targets in srcs into their seed corpus dirs
+func mergeCorpora(targets []fuzz, srcs []string) {
+	var merged, duplicates, invalid, into int
+	for _, f := range targets {
+		dirs := []string{}
+		for _, src := range srcs {
+			dirs = append(dirs, filepath.Join(src, seedDir(f)))
+			if importPath, err := importPathOf(f.pkg); err == nil {
+				dirs = append(dirs,
+					filepath.Join(src, filepath.FromSlash(importPath), f.fn),
+					filepath.Join(src, "fuzz", filepath.FromSlash(importPath), f.fn))
+			}
+		}
+		n, dup, bad, err := mergeCorpus(dirs, seedDir(f))
+		if err != nil {
+			die(err)
+		}
+		if n > 0 {
+			fmt.Printf("%s: merged %d entries into %s\n", f.fullpath, n, seedDir(f))
+			into++
+		}
+		merged, duplicates, invalid = merged+n, duplicates+dup, invalid+bad
+	}
+	fmt.Fprintf(os.Stderr, "merged %d entries into %d targets; left out %d duplicates and %d invalid entries\n", merged, into, duplicates, invalid)
+}
+
+// mergeCorpus copies the entries of the corpus dirs srcs into dst,
+// leaving out those whose content dst already has and those that aren't valid corpus files.
+// missing srcs are treated as empty.
+func mergeCorpus(srcs []string, dst string) (merged int, duplicates int, invalid int, err error) {
+	have, err := corpusHashes(dst)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	for _, src := range srcs {
+		if filepath.Clean(src) == filepath.Clean(dst) {
+			continue
+		}
+		entries, err := os.ReadDir(src)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return merged, duplicates, invalid, fmt.Errorf(`could not read corpus dir "%s": %w`, src, err)
+		}
+		for _, e := range entries {
+			if e.IsDir() {
+				continue
+			}
+			p := filepath.Join(src, e.Name())
+			data, err := os.ReadFile(p)
+			if err != nil {
+				return merged, duplicates, invalid, fmt.Errorf(`could not read corpus entry "%s": %w`, p, err)
+			}
+			err = validateCorpusEntry(data)
+			if err != nil {
+				logger.Warn("leaving out invalid corpus entry", "entry", p, "err", err)
+				invalid++
+				continue
+			}
+			sum := sha256.Sum256(data)
+			if have[sum] {
+				duplicates++
+				continue
+			}
+			err = os.MkdirAll(dst, 0o755)
+			if err != nil {
+				return merged, duplicates, invalid, fmt.Errorf(`could not create corpus dir "%s": %w`, dst, err)
+			}
+			// go names corpus entries after the hash of their content too
+			out := filepath.Join(dst, fmt.Sprintf("%x", sum)[:16])
+			err = os.WriteFile(out, data, 0o644)
+			if err != nil {
+				return merged, duplicates, invalid, fmt.Errorf(`could not write corpus entry "%s": %w`, out, err)
+			}
+			have[sum] = true
+			merged++
+		}
+	}
+	return merged, duplicates, invalid, nil
+}
+
+// dedupCorpora removes the redundant corpus entries of targets,
+// from their seed corpus dirs and, if the cacheDir of cache is set, from the fuzz cache
+func dedupCorpora(targets []fuzz, cache corpusStore, dryRun bool) {
+	removed, size := 0, int64(0)
+	for _, f := range targets {
+		dirs := []string{seedDir(f)}
+		if cache.cacheDir != "" {
+			dir, err := cache.cacheFor(f)
+			if err != nil {
+				logger.Warn("could not find the fuzz cache of the target", "target", f.fullpath, "err", err)
+			} else {
+				dirs = append(dirs, dir)
+			}
+		}
+		redundant, err := redundantEntries(dirs)
+		if err != nil {
+			die(err)
+		}
+		for _, r := range redundant {
+			verb := "removed"
+			if dryRun {
+				verb = "would remove"
+			} else if err := os.Remove(r.path); err != nil {
+				die(fmt.Errorf(`could not remove corpus entry "%s": %w`, r.path, err))
+			}
+			fmt.Printf("%s: %s %s, which %s %s\n", f.fullpath, verb, r.path, r.reason, r.of)
+			removed++
+			size += r.size
+		}
+	}
+	verb := "removed"
+	if dryRun {
+		verb = "would remove"
+	}
+	fmt.Fprintf(os.Stderr, "%s %d redundant entries of %d targets, of %d bytes\n", verb, removed, len(targets), size)
+}
+
+// redundantEntry is a corpus entry that another one makes redundant
+type redundantEntry struct {
+	path string
+	size int64
+	// of is the path of the entry that is kept, and reason how path is the same as it
+	of     string
+	reason string
+}
+
+// redundantEntries returns the entries of the corpus dirs dirs that are byte-identical to,
+// or decode to the same values as, an entry in an earlier dir, or one of an earlier name in the same dir.
+// entries that aren't valid are only compared by their bytes. missing dirs are treated as empty.
+func redundantEntries(dirs []string) ([]redundantEntry, error) {
+	byHash := make(map[[sha256.Size]byte]string)
+	byValues := make(map[string]string)
+	var redundant []redundantEntry
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf(`could not read corpus dir "%s": %w`, dir, err)
+		}
+		// ReadDir sorts the entries by name
+		for _, e := range entries {
+			if e.IsDir() {
+				continue
+			}
+			p := filepath.Join(dir, e.Name())
+			data, err := os.ReadFile(p)
+			if err != nil {
+				return nil, fmt.Errorf(`could not read corpus entry "%s": %w`, p, err)
+			}
+			sum := sha256.Sum256(data)
+			if kept, ok := byHash[sum]; ok {
+				redundant = append(redundant, redundantEntry{p, int64(len(data)), kept, "is byte-identical to"})
+				continue
+			}
+			byHash[sum] = p
+			values, err := decodeCorpusEntry(data)
+			if err != nil {
+				continue
+			}
+			key := ""
+			for _, v := range values {
+				key += v.String() + "\n"
+			}
+			if kept, ok := byValues[key]; ok {
+				redundant = append(redundant, redundantEntry{p, int64(len(data)), kept, "has the same values as"})
+				continue
+			}
+			byValues[key] = p
+		}
+	}
+	return redundant, nil
+}
+
+// corpusHashes returns the hashes of the content of the entries of the corpus dir at dir
+func corpusHashes(dir string) (map[[sha256.Size]byte]bool, error) {
+	hashes := make(map[[sha256.Size]byte]bool)
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return hashes, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf(`could not read corpus dir "%s": %w`, dir, err)
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, fmt.Errorf(`could not read corpus entry "%s": %w`, e.Name(), err)
+		}
+		hashes[sha256.Sum256(data)] = true
+	}
+	return hashes, nil
+}
+
+// corpusTypes are the types of the values that corpus entries can have
+var corpusTypes = map[string]bool{
+	"[]byte": true, "string": true, "bool": true, "byte": true, "rune": true,
+	"int": true, "int8": true, "int16": true, "int32": true, "int64": true,
+	"uint": true, "uint8": true, "uint16": true, "uint32": true, "uint64": true,
+	"float32": true, "float64": true,
+}
+
+// validateCorpusEntry checks that data is a valid corpus entry in the go test fuzz v1 format
+func validateCorpusEntry(data []byte) error {
+	_, err := decodeCorpusEntry(data)
+	return err
+}
+
+// corpusValue is a decoded value of a corpus entry
+type corpusValue struct {
+	typ string
+	// value is the value in a canonical form, so that values that are written differently
+	// but are the same, such as int(16) and int(0x10), have the same one
+	value string
+}
+
+func (v corpusValue) String() string {
+	return v.typ + "(" + v.value + ")"
+}
+
+// decodeCorpusEntry decodes the values of a corpus entry in the go test fuzz v1 format,
+// which is its header line followed by a line per value, such as []byte("abc") or int(-1)
+func decodeCorpusEntry(data []byte) ([]corpusValue, error) {
+	if !bytes.HasPrefix(data, []byte(corpusHeader)) {
+		return nil, errors.New("missing the go test fuzz v1 header")
+	}
+	sc := bufio.NewScanner(bytes.NewReader(data[len(corpusHeader):]))
+	sc.Buffer(nil, len(data)+1)
+	var values []corpusValue
+	for n := 2; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		v, err := parseCorpusValue(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		values = append(values, v)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, errors.New("no values")
+	}
+	return values, nil
+}
+
+// parseCorpusValue parses a line of a corpus entry, such as int(-1)
+func parseCorpusValue(line string) (corpusValue, error) {
+	expr, err := parser.ParseExpr(line)
+	if err != nil {
+		return corpusValue{}, fmt.Errorf("invalid value: %w", err)
+	}
+	call, ok := expr.(*ast.CallExpr)
+	if !ok || len(call.Args) != 1 {
+		return corpusValue{}, fmt.Errorf(`invalid value "%s": expected a conversion such as int(1)`, line)
+	}
+	typ := exprSource(call.Fun)
+	if !corpusTypes[typ] {
+		return corpusValue{}, fmt.Errorf(`invalid value "%s": unsupported type "%s"`, line, typ)
+	}
+	arg, neg := call.Args[0], false
+	if u, ok := arg.(*ast.UnaryExpr); ok && (u.Op == token.SUB || u.Op == token.ADD) {
+		arg, neg = u.X, u.Op == token.SUB
+	}
+	value, err := "", errors.New("expected a literal")
+	switch arg := arg.(type) {
+	case *ast.BasicLit:
+		value, err = canonicalLiteral(typ, arg, neg)
+	case *ast.Ident:
+		if typ == "bool" && !neg && (arg.Name == "true" || arg.Name == "false") {
+			value, err = arg.Name, nil
+		}
+	case *ast.CallExpr:
+		// go writes floats that have no literal, such as NaNs, as math.Float64frombits(0x...)
+		fn := exprSource(arg.Fun)
+		if (fn == "math.Float32frombits" && typ == "float32" || fn == "math.Float64frombits" && typ == "float64") && len(arg.Args) == 1 && !neg {
+			if lit, ok := arg.Args[0].(*ast.BasicLit); ok && lit.Kind == token.INT {
+				if bits, ok := new(big.Int).SetString(lit.Value, 0); ok {
+					value, err = "bits:"+bits.Text(16), nil
+				}
+			}
+		}
+	}
+	if err != nil {
+		return corpusValue{}, fmt.Errorf(`invalid value "%s": %w`, line, err)
+	}
+	return corpusValue{typ: typ, value: value}, nil
+}
+
+// canonicalLiteral returns the canonical form of a literal of a value of type typ, negated if neg is set.
+// floats are in the form of their bits, as those without a literal are.
+func canonicalLiteral(typ string, lit *ast.BasicLit, neg bool) (string, error) {
+	if lit.Kind == token.STRING {
+		if (typ != "string" && typ != "[]byte") || neg {
+			return "", fmt.Errorf("a string is not a valid %s", typ)
+		}
+		s, err := strconv.Unquote(lit.Value)
+		return strconv.Quote(s), err
+	}
+	if typ == "string" || typ == "[]byte" || typ == "bool" {
+		return "", fmt.Errorf("a number is not a valid %s", typ)
+	}
+	var f *big.Float
+	switch lit.Kind {
+	case token.CHAR:
+		r, _, _, err := strconv.UnquoteChar(strings.Trim(lit.Value, "'"), '\'')
+		if err != nil {
+			return "", err
+		}
+		f = new(big.Float).SetInt64(int64(r))
+	case token.INT:
+		// big.Float doesn't take the legacy octal form, as in 0755
+		n, ok := new(big.Int).SetString(lit.Value, 0)
+		if !ok {
+			return "", fmt.Errorf(`invalid number "%s"`, lit.Value)
+		}
+		f = new(big.Float).SetInt(n)
+	case token.FLOAT:
+		var ok bool
+		f, ok = new(big.Float).SetPrec(256).SetString(lit.Value)
+		if !ok {
+			return "", fmt.Errorf(`invalid number "%s"`, lit.Value)
+		}
+	default:
+		return "", fmt.Errorf(`invalid literal "%s"`, lit.Value)
+	}
+	if neg {
+		f.Neg(f)
+	}
+	switch typ {
+	case "float32":
+		v, _ := f.Float32()
+		return "bits:" + strconv.FormatUint(uint64(math.Float32bits(v)), 16), nil
+	case "float64":
+		v, _ := f.Float64()
+		return "bits:" + strconv.FormatUint(math.Float64bits(v), 16), nil
+	}
+	n, acc := f.Int(nil)
+	if acc != big.Exact {
+		return "", fmt.Errorf(`"%s" is not a valid %s`, lit.Value, typ)
+	}
+	return n.String(), nil
+}
+
+// exprSource returns the source of the type expression of a conversion, such as []byte
+func exprSource(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		return e.Name
+	case *ast.ArrayType:
+		if e.Len == nil {
+			return "[]" + exprSource(e.Elt)
+		}
+	case *ast.SelectorExpr:
+		return exprSource(e.X) + "." + e.Sel.Name
+	}
+	return ""
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// ageBuckets are the bounds of the age distribution of corpus stats
+var ageBuckets = []struct {
+	name string
+	max  time.Duration
+}{
+	{"< 1 day", 24 * time.Hour},
+	{"< 1 week", 7 * 24 * time.Hour},
+	{"< 1 month", 30 * 24 * time.Hour},
+	{"< 1 year", 365 * 24 * time.Hour},
+}
+
+// corpusStats describes the corpus of a target
+type corpusStats struct {
+	target string
+	// entries and size are those of the seed corpus dir, and cached and cachedSize those of the fuzz cache
+	entries    int
+	size       int64
+	cached     int
+	cachedSize int64
+	// seeds is the number of f.Add seeds
+	seeds int
+	// ages are the ages of the entries of the seed corpus dir, from the newest
+	ages []time.Duration
+	// signatures are the distinct types of the values of the entries, such as ([]byte, int),
+	// by how many entries have them
+	signatures map[string]int
+}
+
+// readCorpusStats returns the stats of the corpus of f, whose fuzz cache dir is cache, if known
+func readCorpusStats(f fuzz, cache string, now time.Time) (corpusStats, error) {
+	s := corpusStats{target: f.fullpath, seeds: len(f.seeds), signatures: make(map[string]int)}
+	dir := seedDir(f)
+	entries, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return s, fmt.Errorf(`could not read corpus dir "%s": %w`, dir, err)
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return s, fmt.Errorf(`could not stat corpus entry "%s": %w`, e.Name(), err)
+		}
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return s, fmt.Errorf(`could not read corpus entry "%s": %w`, e.Name(), err)
+		}
+		s.entries++
+		s.size += info.Size()
+		s.ages = append(s.ages, max(now.Sub(info.ModTime()), 0))
+		s.signatures[corpusSignature(data)]++
+	}
+	sort.Slice(s.ages, func(i, j int) bool { return s.ages[i] < s.ages[j] })
+	if cache != "" {
+		s.cached, s.cachedSize, err = dirEntries(cache)
+		if err != nil {
+			return s, err
+		}
+	}
+	return s, nil
+}
+
+// corpusSignature returns the types of the values of a corpus entry, such as ([]byte, int),
+// or "invalid" if it isn't a valid corpus entry
+func corpusSignature(data []byte) string {
+	values, err := decodeCorpusEntry(data)
+	if err != nil {
+		return "invalid"
+	}
+	types := make([]string, len(values))
+	for i, v := range values {
+		types[i] = v.typ
+	}
+	return "(" + strings.Join(types, ", ") + ")"
+}
+
+// dirEntries returns the number and total size of the files in dir, which is treated as empty if missing
+func dirEntries(dir string) (int, int64, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf(`could not read corpus dir "%s": %w`, dir, err)
+	}
+	n, size := 0, int64(0)
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || e.IsDir() {
+			continue
+		}
+		n++
+		size += info.Size()
+	}
+	return n, size, nil
+}
+
+// notes returns what stands out about the corpus: that it's empty, larger than large, or of mixed signatures
+func (s corpusStats) notes(large int64) string {
+	var notes []string
+	if s.entries == 0 && s.seeds == 0 {
+		notes = append(notes, "empty")
+	}
+	if large > 0 && s.size > large {
+		notes = append(notes, "large")
+	}
+	if len(s.signatures) > 1 {
+		notes = append(notes, "mixed signatures")
+	}
+	if s.signatures["invalid"] > 0 {
+		notes = append(notes, "invalid entries")
+	}
+	return strings.Join(notes, ", ")
+}
+
+// signatureList returns the signatures of the entries, the most common first,
+// with the number of entries of each if there's more than one
+func (s corpusStats) signatureList() string {
+	sigs := make([]string, 0, len(s.signatures))
+	for sig := range s.signatures {
+		sigs = append(sigs, sig)
+	}
+	sort.Slice(sigs, func(i, j int) bool {
+		if s.signatures[sigs[i]] != s.signatures[sigs[j]] {
+			return s.signatures[sigs[i]] > s.signatures[sigs[j]]
+		}
+		return sigs[i] < sigs[j]
+	})
+	if len(sigs) == 1 {
+		return sigs[0]
+	}
+	for i, sig := range sigs {
+		sigs[i] = fmt.Sprintf("%s x%d", sig, s.signatures[sig])
+	}
+	return strings.Join(sigs, " ")
+}
+
+// printCorpusStats writes a table of the stats of the corpora to w,
+// followed by their totals and the age distribution of their entries
+func printCorpusStats(w io.Writer, stats []corpusStats, large int64) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "target\tentries\tsize\tf.Add seeds\tcached\tcached size\tnewest\tmedian age\toldest\tsignature\t")
+	var entries, cached int
+	var size, cachedSize int64
+	var ages []time.Duration
+	for _, s := range stats {
+		newest, median, oldest := "-", "-", "-"
+		if len(s.ages) > 0 {
+			newest, median, oldest = formatAge(s.ages[0]), formatAge(s.ages[len(s.ages)/2]), formatAge(s.ages[len(s.ages)-1])
+		}
+		signature := "-"
+		if len(s.signatures) > 0 {
+			signature = s.signatureList()
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%d\t%s\t%s\t%s\t%s\t%s\n", s.target, s.entries, s.size, s.seeds,
+			s.cached, s.cachedSize, newest, median, oldest, signature, s.notes(large))
+		entries, size, cached, cachedSize = entries+s.entries, size+s.size, cached+s.cached, cachedSize+s.cachedSize
+		ages = append(ages, s.ages...)
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "\n%d targets: %d entries of %d bytes in testdata, %d entries of %d bytes in the fuzz cache\n",
+		len(stats), entries, size, cached, cachedSize)
+	if len(ages) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "\nage of the entries in testdata:")
+	counts := make([]int, len(ageBuckets)+1)
+	for _, age := range ages {
+		i := 0
+		for i < len(ageBuckets) && age >= ageBuckets[i].max {
+			i++
+		}
+		counts[i]++
+	}
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for i, b := range ageBuckets {
+		fmt.Fprintf(tw, "  %s\t%d\n", b.name, counts[i])
+	}
+	fmt.Fprintf(tw, "  older\t%d\n", counts[len(ageBuckets)])
+	tw.Flush()
+}
+
+// formatAge formats an age in hours under a day, and in days otherwise
+func formatAge(d time.Duration) string {
+	if d < 24*time.Hour {
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	}
+	return fmt.Sprintf("%dd", int(d.Hours()/24))
+}
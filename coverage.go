@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// coverageRgx matches the coverage that go test reports with -coverprofile
+var coverageRgx = regexp.MustCompile(`(?m)^coverage: ([0-9.]+)% of statements`)
+
+// coverprofile returns the path of the coverage profile of f under the -coverprofile-dir,
+// which mirrors the package tree, as in DIR/path/to/package/FuzzFuncName.cover
+func (r runner) coverprofile(f fuzz) string {
+	return coverprofilePath(r.coverDir, f)
+}
+
+// coverprofilePath returns the path of the coverage profile of f under dir
+func coverprofilePath(dir string, f fuzz) string {
+	return filepath.Join(dir, filepath.FromSlash(f.pkg), f.fn+".cover")
+}
+
+// coverArgs returns the args that make a run of the seed corpus of f write its coverage profile,
+// or nothing if coverage isn't collected. go test can't collect coverage while fuzzing.
+func (r runner) coverArgs(f fuzz) ([]string, error) {
+	if r.coverDir == "" {
+		return nil, nil
+	}
+	p := r.coverprofile(f)
+	err := os.MkdirAll(filepath.Dir(p), 0o755)
+	if err != nil {
+		return nil, fmt.Errorf(`could not create coverage dir "%s": %w`, filepath.Dir(p), err)
+	}
+	args := []string{"-coverprofile=" + p}
+	if r.coverPkg != "" {
+		args = append(args, "-coverpkg="+r.coverPkg)
+	}
+	return args, nil
+}
+
+// cover runs the seed corpus of f to collect its coverage profile
+func (r runner) cover(f fuzz) {
+	args, err := r.coverArgs(f)
+	if err != nil {
+		logger.Warn("could not collect coverage", "target", f.fullpath, "err", err)
+		return
+	}
+	res := r.exec(f, false, args...)
+	logCoverage(f, res, r.coverprofile(f))
+}
+
+// logCoverage logs the coverage that a run of the seed corpus of f collected into the profile at p
+func logCoverage(f fuzz, res result, p string) {
+	if _, err := os.Stat(p); err != nil {
+		logger.Warn("could not collect coverage", "target", f.fullpath, "err", res.err)
+		return
+	}
+	coverage := "unknown"
+	if m := coverageRgx.FindStringSubmatch(res.output); m != nil {
+		coverage = m[1] + "%"
+	}
+	logger.Info("collected coverage", "target", f.fullpath, "profile", p, "coverage", coverage)
+}
+
+// coverBlock is a block of statements in a coverage profile
+type coverBlock struct {
+	// pkg is the import path of the package of the block
+	pkg     string
+	stmts   int
+	covered bool
+}
+
+// readCoverprofile reads the blocks of the coverage profile at p, by their position
+func readCoverprofile(p string) (map[string]coverBlock, error) {
+	file, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	blocks := make(map[string]coverBlock)
+	sc := bufio.NewScanner(file)
+	for sc.Scan() {
+		// lines are FILE:START,END STMTS COUNT, after a mode line
+		fields := strings.Fields(sc.Text())
+		if len(fields) != 3 || strings.HasPrefix(fields[0], "mode:") {
+			continue
+		}
+		file, _, ok := strings.Cut(fields[0], ":")
+		stmts, err1 := strconv.Atoi(fields[1])
+		count, err2 := strconv.Atoi(fields[2])
+		if !ok || err1 != nil || err2 != nil {
+			return nil, fmt.Errorf(`invalid coverage profile "%s": invalid line "%s"`, p, sc.Text())
+		}
+		b := blocks[fields[0]]
+		b.pkg, b.stmts, b.covered = path.Dir(file), stmts, b.covered || count > 0
+		blocks[fields[0]] = b
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf(`could not read coverage profile "%s": %w`, p, err)
+	}
+	return blocks, nil
+}
+
+// prioritizeByCoverage orders targets by how exercised the packages they cover are,
+// which is the fraction of their statements that any of the coverage profiles under dir covers,
+// so that the targets that cover the least exercised packages run first.
+// targets without a profile run first, as what they cover isn't known, and so may be exercised the least.
+func prioritizeByCoverage(targets []fuzz, dir string) []fuzz {
+	profiles := make([]map[string]coverBlock, len(targets))
+	all := make(map[string]coverBlock)
+	for i, f := range targets {
+		blocks, err := readCoverprofile(coverprofilePath(dir, f))
+		if err != nil {
+			if !os.IsNotExist(err) {
+				logger.Warn("could not read coverage profile", "target", f.fullpath, "err", err)
+			}
+			continue
+		}
+		profiles[i] = blocks
+		for pos, b := range blocks {
+			b.covered = b.covered || all[pos].covered
+			all[pos] = b
+		}
+	}
+	// the fraction of the statements of each package that some target covers
+	stmts, covered := make(map[string]int), make(map[string]int)
+	for _, b := range all {
+		stmts[b.pkg] += b.stmts
+		if b.covered {
+			covered[b.pkg] += b.stmts
+		}
+	}
+	exercised := func(pkg string) float64 {
+		if stmts[pkg] == 0 {
+			return 0
+		}
+		return float64(covered[pkg]) / float64(stmts[pkg])
+	}
+	scores := make(map[string]float64, len(targets))
+	for i, f := range targets {
+		score := -1.0
+		if profiles[i] != nil {
+			score = leastExercised(profiles[i], exercised)
+		}
+		scores[f.fullpath] = score
+		logger.Debug("prioritized target", "target", f.fullpath, "least-exercised", score)
+	}
+	ordered := make([]fuzz, len(targets))
+	copy(ordered, targets)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return scores[ordered[i].fullpath] < scores[ordered[j].fullpath]
+	})
+	return ordered
+}
+
+// leastExercised returns how exercised the least exercised package that the blocks cover is.
+// if they cover nothing, the packages that they are of count instead.
+func leastExercised(blocks map[string]coverBlock, exercised func(pkg string) float64) float64 {
+	least, found := 1.0, false
+	for _, b := range blocks {
+		if b.covered {
+			least, found = min(least, exercised(b.pkg)), true
+		}
+	}
+	if found {
+		return least
+	}
+	for _, b := range blocks {
+		least = min(least, exercised(b.pkg))
+	}
+	return least
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// clockTicks is the number of clock ticks per second that /proc reports cpu times in,
+// which is 100 on all the architectures that linux supports
+const clockTicks = 100
+
+// procStat is what resource accounting needs of the /proc/PID/stat of a process
+type procStat struct {
+	pid, ppid int
+	// ticks is the cpu time of the process and of its children that it waited for
+	ticks int64
+	// rss is the resident set size of the process, in pages
+	rss int64
+}
+
+// readProcStats returns the stats of all the processes
+func readProcStats() ([]procStat, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+	var stats []procStat
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile("/proc/" + entry.Name() + "/stat")
+		if err != nil {
+			// the process has exited
+			continue
+		}
+		// the command name may contain spaces and parentheses, so skip past its last ")"
+		s := string(data)
+		fields := strings.Fields(s[strings.LastIndexByte(s, ')')+1:])
+		if len(fields) < 22 {
+			continue
+		}
+		st := procStat{pid: pid}
+		st.ppid, _ = strconv.Atoi(fields[1])
+		// utime, stime, cutime and cstime
+		for _, f := range fields[11:15] {
+			n, _ := strconv.ParseInt(f, 10, 64)
+			st.ticks += n
+		}
+		st.rss, _ = strconv.ParseInt(fields[21], 10, 64)
+		stats = append(stats, st)
+	}
+	return stats, nil
+}
+
+// descendants returns the stats of pid and of all of its descendants
+func descendants(stats []procStat, pid int) []procStat {
+	var tree []procStat
+	pids := map[int]bool{pid: true}
+	for changed := true; changed; {
+		changed = false
+		for _, st := range stats {
+			if !pids[st.pid] && pids[st.ppid] {
+				pids[st.pid] = true
+				changed = true
+			}
+		}
+	}
+	for _, st := range stats {
+		if pids[st.pid] {
+			tree = append(tree, st)
+		}
+	}
+	return tree
+}
+
+// treeCPUTime returns the cpu time used by the process pid and all of its descendants so far
+func treeCPUTime(pid int) (time.Duration, error) {
+	cpu, _, err := treeUsage(pid)
+	return cpu, err
+}
+
+// treeUsage returns the cpu time used so far by the process pid and all of its descendants,
+// and the memory that they use, in bytes
+func treeUsage(pid int) (cpu time.Duration, mem int64, err error) {
+	stats, err := readProcStats()
+	if err != nil {
+		return 0, 0, fmt.Errorf("could not read process stats: %w", err)
+	}
+	var ticks, rss int64
+	for _, st := range descendants(stats, pid) {
+		ticks += st.ticks
+		rss += st.rss
+	}
+	return time.Duration(ticks) * time.Second / clockTicks, rss * int64(os.Getpagesize()), nil
+}
+
+// interruptChildren interrupts the children of the process pid.
+// go test leaves interrupts to the test binary, which stops fuzzing and passes.
+func interruptChildren(pid int) error {
+	stats, err := readProcStats()
+	if err != nil {
+		return fmt.Errorf("could not read process stats: %w", err)
+	}
+	for _, st := range stats {
+		if st.ppid == pid {
+			syscall.Kill(st.pid, syscall.SIGINT)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+// errNoCPUAccounting is returned where the resource usage of running processes isn't known
+var errNoCPUAccounting = errors.New("resource accounting is not supported on this platform")
+
+// treeCPUTime fails, as the cpu time of running processes isn't known on this platform
+func treeCPUTime(pid int) (time.Duration, error) {
+	return 0, errNoCPUAccounting
+}
+
+// treeUsage fails, as the resource usage of running processes isn't known on this platform
+func treeUsage(pid int) (cpu time.Duration, mem int64, err error) {
+	return 0, 0, errNoCPUAccounting
+}
+
+// interruptChildren fails, as the processes of this platform can't be walked
+func interruptChildren(pid int) error {
+	return errNoCPUAccounting
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"math"
+	"os"
+	"runtime"
+	"strconv"
+)
+
+// maxDefaultParallel is the most tests that run in parallel by default
+const maxDefaultParallel = 10
+
+// availableCPUs returns the number of cpus that gofuzz may use,
+// which is less than the cpus of the machine if a cgroup cpu quota limits it,
+// and whether that's the case. a fractional quota, such as 1.5 cpus, is rounded up.
+func availableCPUs() (int, bool) {
+	cpus := runtime.NumCPU()
+	quota := cgroupCPUQuota()
+	if quota <= 0 {
+		return cpus, false
+	}
+	limited := max(int(math.Ceil(quota)), 1)
+	if limited >= cpus {
+		return cpus, false
+	}
+	return limited, true
+}
+
+// defaultParallel returns the default -parallel, which is the number of available cpus, up to maxDefaultParallel,
+// as each go test runs a fuzzing worker on every cpu of its own.
+// without a cgroup cpu quota, that's the number of cpus of the machine.
+func defaultParallel() int {
+	cpus, limited := availableCPUs()
+	n := min(cpus, maxDefaultParallel)
+	logger.Debug("chose the default -parallel", "parallel", n, "cpus", cpus, "cgroup-quota", limited)
+	return n
+}
+
+// gomaxprocsEnv returns the GOMAXPROCS variable that makes the go commands, and the fuzzing workers of their
+// test binaries, use the cpus that a cgroup cpu quota allows rather than all the cpus of the machine,
+// which go versions before 1.25 don't do by themselves. it returns nothing if there's no quota,
+// or if GOMAXPROCS is already set.
+func gomaxprocsEnv() []string {
+	if _, ok := os.LookupEnv("GOMAXPROCS"); ok {
+		return nil
+	}
+	cpus, limited := availableCPUs()
+	if !limited {
+		return nil
+	}
+	return []string{"GOMAXPROCS=" + strconv.Itoa(cpus)}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// parseDeadline parses a -deadline, which is either an RFC3339 time, or a duration from now
+func parseDeadline(s string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(d), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf(`invalid -deadline value "%s": expected an RFC3339 time or a duration`, s)
+	}
+	return t, nil
+}
+
+// deadlineFuzztime returns the -fuzztime that makes a target whose fuzzing args are args
+// stop fuzzing by stop, or an empty string if its own -fuzztime already does.
+// it returns false if there's no time left to fuzz before stop.
+func deadlineFuzztime(args []string, stop time.Time, now time.Time) (string, bool) {
+	left := stop.Sub(now).Truncate(time.Second)
+	if left < time.Second {
+		return "", false
+	}
+	// a fuzztime that is a number of executions, or no fuzztime, may take any time
+	if d := fuzztimeDuration(fuzztimeArg(args)); d > 0 && d <= left {
+		return "", true
+	}
+	return "-fuzztime=" + left.String(), true
+}
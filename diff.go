@@ -0,0 +1,186 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+const diffHelpText = `Usage: gofuzz diff [OPTIONS...] RUN_A RUN_B
+
+diff compares two runs recorded in the stats DB specified by -stats-dir,
+and reports regressions (targets failing in RUN_B but not in RUN_A),
+fixes (targets failing in RUN_A but not in RUN_B),
+and targets whose duration changed notably.
+"latest" and "previous" can be used in place of the last two run ids.
+the exit status is 1 if there are regressions.
+
+Options:
+`
+
+// failingStatuses are the statuses that diff considers failures
+var failingStatuses = map[string]bool{
+	"fail":   true,
+	"broken": true,
+}
+
+// runRecords returns the last record of each target in the given run,
+// keyed by target path. run may also be "latest" or "previous".
+func runRecords(recs []statsRecord, run string) (map[string]statsRecord, error) {
+	// records are ordered by start time, so runs are listed in the order they started
+	var runs []string
+	seen := make(map[string]bool)
+	for _, rec := range recs {
+		if !seen[rec.Run] {
+			seen[rec.Run] = true
+			runs = append(runs, rec.Run)
+		}
+	}
+	switch run {
+	case "latest":
+		if len(runs) < 1 {
+			return nil, fmt.Errorf("the stats DB contains no runs")
+		}
+		run = runs[len(runs)-1]
+	case "previous":
+		if len(runs) < 2 {
+			return nil, fmt.Errorf("the stats DB contains fewer than two runs")
+		}
+		run = runs[len(runs)-2]
+	}
+	if !seen[run] {
+		return nil, fmt.Errorf(`run "%s" not found in the stats DB`, run)
+	}
+	out := make(map[string]statsRecord)
+	for _, rec := range recs {
+		if rec.Run == run {
+			out[rec.Target] = rec
+		}
+	}
+	return out, nil
+}
+
+// runDiff is the difference between two runs
+type runDiff struct {
+	// regressions and fixes are target paths
+	regressions, fixes []string
+	// added and removed are targets present in only one of the runs
+	added, removed []string
+	// slower and faster are targets whose duration changed notably
+	slower, faster []string
+	a, b           map[string]statsRecord
+}
+
+// diffRuns compares the records of two runs.
+// a duration change is notable if it's more than threshold times the old duration.
+func diffRuns(a, b map[string]statsRecord, threshold float64) runDiff {
+	d := runDiff{a: a, b: b}
+	for target, recB := range b {
+		recA, ok := a[target]
+		if !ok {
+			d.added = append(d.added, target)
+			if failingStatuses[recB.Status] {
+				d.regressions = append(d.regressions, target)
+			}
+			continue
+		}
+		if failingStatuses[recB.Status] && !failingStatuses[recA.Status] {
+			d.regressions = append(d.regressions, target)
+		}
+		if failingStatuses[recA.Status] && recB.Status == "pass" {
+			d.fixes = append(d.fixes, target)
+		}
+		if recA.Duration > 0 {
+			change := float64(recB.Duration-recA.Duration) / float64(recA.Duration)
+			if change > threshold {
+				d.slower = append(d.slower, target)
+			} else if -change > threshold {
+				d.faster = append(d.faster, target)
+			}
+		}
+	}
+	for target := range a {
+		if _, ok := b[target]; !ok {
+			d.removed = append(d.removed, target)
+		}
+	}
+	for _, l := range [][]string{d.regressions, d.fixes, d.added, d.removed, d.slower, d.faster} {
+		sort.Strings(l)
+	}
+	return d
+}
+
+// print writes the diff to w in a human-readable form
+func (d runDiff) print(w io.Writer) {
+	status := func(recs map[string]statsRecord, target string) string {
+		rec, ok := recs[target]
+		if !ok {
+			return "absent"
+		}
+		return rec.Status
+	}
+	section := func(title string, targets []string, line func(target string) string) {
+		if len(targets) == 0 {
+			return
+		}
+		fmt.Fprintf(w, "===== %s =====\n", title)
+		for _, t := range targets {
+			fmt.Fprintln(w, line(t))
+		}
+		fmt.Fprintln(w)
+	}
+	statusLine := func(target string) string {
+		return fmt.Sprintf("%s: %s -> %s", target, status(d.a, target), status(d.b, target))
+	}
+	durationLine := func(target string) string {
+		before, after := d.a[target].Duration, d.b[target].Duration
+		return fmt.Sprintf("%s: %s -> %s (%+.0f%%)", target,
+			before.Round(time.Millisecond), after.Round(time.Millisecond),
+			100*float64(after-before)/float64(before))
+	}
+	section("regressions", d.regressions, statusLine)
+	section("fixes", d.fixes, statusLine)
+	section("new targets", d.added, statusLine)
+	section("removed targets", d.removed, statusLine)
+	section("slower", d.slower, durationLine)
+	section("faster", d.faster, durationLine)
+}
+
+// diffCmd implements the diff subcommand
+func diffCmd(args []string) {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, diffHelpText)
+		flags.PrintDefaults()
+	}
+	statsDir := flags.String("stats-dir", "", "stats DB to read the runs from")
+	threshold := flags.Float64("threshold", 0.5, "relative duration change above which a target is reported as slower or faster")
+	flags.Parse(args)
+	if *statsDir == "" {
+		die("-stats-dir is required.")
+	}
+	if flags.NArg() != 2 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	recs, err := statsDB{dir: *statsDir}.records()
+	if err != nil {
+		die(err)
+	}
+	a, err := runRecords(recs, flags.Arg(0))
+	if err != nil {
+		die(err)
+	}
+	b, err := runRecords(recs, flags.Arg(1))
+	if err != nil {
+		die(err)
+	}
+	d := diffRuns(a, b, *threshold)
+	d.print(os.Stdout)
+	if len(d.regressions) > 0 {
+		os.Exit(1)
+	}
+}
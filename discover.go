@@ -0,0 +1,539 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// fuzzRgx is a regexp that matches go fuzz functions
+var fuzzRgx = regexp.MustCompile(`^func\s+(Fuzz\w+)`)
+
+// argsDirective is the prefix of comment lines above a fuzz function
+// that specify extra go test args for it, as in //gofuzz:args -tags=integration
+const argsDirective = "//gofuzz:args"
+
+// envDirective is the prefix of comment lines above a fuzz function
+// that set environment variables for it, as in //gofuzz:env GOGC=400 GOMEMLIMIT=2GiB
+const envDirective = "//gofuzz:env"
+
+// discoveryCacheVersion is bumped whenever what's cached per file changes
+const discoveryCacheVersion = 5
+
+// scannedFunc is a fuzz function found in a test file
+type scannedFunc struct {
+	Fn string `json:"fn"`
+	// Line is the line that the function is on
+	Line int `json:"line"`
+	// Args are the extra go test args given by directives
+	Args []string `json:"args,omitempty"`
+	// Env are the NAME=VALUE environment variables given by directives
+	Env []string `json:"env,omitempty"`
+	// Seeds are the f.Add calls of the function
+	Seeds []inlineSeed `json:"seeds,omitempty"`
+}
+
+// discoveryCache remembers the fuzz functions found in each test file,
+// so that files that haven't changed since the last run aren't scanned again
+type discoveryCache struct {
+	path    string
+	Version int                   `json:"version"`
+	Files   map[string]cachedFile `json:"files"`
+	changed bool
+}
+
+// cachedFile is the discovery result of a single file
+type cachedFile struct {
+	ModTime time.Time     `json:"mtime"`
+	Size    int64         `json:"size"`
+	Funcs   []scannedFunc `json:"funcs"`
+}
+
+// loadDiscoveryCache loads the discovery cache of the project in the current dir.
+// a missing or corrupt cache is treated as empty.
+func loadDiscoveryCache() *discoveryCache {
+	cache := &discoveryCache{
+		Version: discoveryCacheVersion,
+		Files:   make(map[string]cachedFile),
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return cache
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return cache
+	}
+	sum := sha256.Sum256([]byte(wd))
+	cache.path = filepath.Join(dir, "gofuzz", "discovery-"+hex.EncodeToString(sum[:8])+".json")
+	data, err := os.ReadFile(cache.path)
+	if err != nil {
+		return cache
+	}
+	var loaded discoveryCache
+	err = json.Unmarshal(data, &loaded)
+	if err != nil || loaded.Files == nil || loaded.Version != discoveryCacheVersion {
+		return cache
+	}
+	cache.Files = loaded.Files
+	return cache
+}
+
+// lookup returns the cached fuzz functions of the file at p,
+// if the file hasn't changed since it was cached
+func (c *discoveryCache) lookup(p string, info fs.FileInfo) ([]scannedFunc, bool) {
+	if c == nil {
+		return nil, false
+	}
+	f, ok := c.Files[p]
+	if !ok || f.Size != info.Size() || !f.ModTime.Equal(info.ModTime()) {
+		return nil, false
+	}
+	return f.Funcs, true
+}
+
+// store caches the fuzz functions of the file at p
+func (c *discoveryCache) store(p string, info fs.FileInfo, fns []scannedFunc) {
+	if c == nil {
+		return
+	}
+	c.Files[p] = cachedFile{
+		ModTime: info.ModTime(),
+		Size:    info.Size(),
+		Funcs:   fns,
+	}
+	c.changed = true
+}
+
+// prune removes the entries of files that weren't seen in the last walk
+func (c *discoveryCache) prune(seen map[string]bool) {
+	if c == nil {
+		return
+	}
+	for p := range c.Files {
+		if !seen[p] {
+			delete(c.Files, p)
+			c.changed = true
+		}
+	}
+}
+
+// save writes the cache to disk if it has changed
+func (c *discoveryCache) save() error {
+	if c == nil || !c.changed || c.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(c.path), 0o755)
+	if err != nil {
+		return fmt.Errorf(`could not create cache dir: %w`, err)
+	}
+	// write to a temporary file first, so that concurrent runs
+	// never observe a partially written cache
+	tmp := c.path + fmt.Sprintf(".%d.tmp", os.Getpid())
+	err = os.WriteFile(tmp, data, 0o644)
+	if err != nil {
+		return fmt.Errorf(`could not write cache "%s": %w`, tmp, err)
+	}
+	err = os.Rename(tmp, c.path)
+	if err != nil {
+		return fmt.Errorf(`could not write cache "%s": %w`, c.path, err)
+	}
+	return nil
+}
+
+// scanFuzzFuncs returns the fuzz functions in the file at p,
+// along with the directives in the comments right above them
+func scanFuzzFuncs(p string) ([]scannedFunc, error) {
+	file, err := os.Open(p)
+	if err != nil {
+		return nil, fmt.Errorf(`could not open file "%s": %w`, p, err)
+	}
+	defer file.Close()
+	var fns []scannedFunc
+	var args, env []string
+	sc := bufio.NewScanner(file)
+	for n := 1; sc.Scan(); n++ {
+		line := sc.Text()
+		if strings.HasPrefix(line, "//") {
+			if rest, ok := strings.CutPrefix(line, argsDirective); ok {
+				words, err := splitCommand(rest)
+				if err != nil {
+					return nil, fmt.Errorf(`invalid %s directive in "%s": %w`, argsDirective, p, err)
+				}
+				args = append(args, words...)
+			}
+			if rest, ok := strings.CutPrefix(line, envDirective); ok {
+				words, err := splitCommand(rest)
+				if err != nil {
+					return nil, fmt.Errorf(`invalid %s directive in "%s": %w`, envDirective, p, err)
+				}
+				for _, w := range words {
+					if name, _, ok := strings.Cut(w, "="); !ok || name == "" {
+						return nil, fmt.Errorf(`invalid %s directive in "%s": "%s" is not of the form NAME=VALUE`, envDirective, p, w)
+					}
+				}
+				env = append(env, words...)
+			}
+			continue
+		}
+		matches := fuzzRgx.FindStringSubmatch(line)
+		if matches == nil || len(matches) < 2 {
+			// directives only apply to the function right below them
+			args, env = nil, nil
+			continue
+		}
+		fns = append(fns, scannedFunc{Fn: matches[1], Line: n, Args: args, Env: env})
+		args, env = nil, nil
+	}
+	err = sc.Err()
+	if err != nil {
+		return nil, fmt.Errorf(`could not scan "%s": %w`, p, err)
+	}
+	if len(fns) > 0 {
+		scanInlineSeeds(p, fns)
+	}
+	return fns, nil
+}
+
+// walkOptions controls how walkTree traverses the project
+type walkOptions struct {
+	// followSymlinks makes the walk descend into symlinked dirs
+	followSymlinks bool
+	// workspace makes the walk descend into nested modules
+	workspace bool
+	// skipErrors makes unreadable files and dirs be skipped with a warning
+	// instead of aborting the walk
+	skipErrors bool
+}
+
+// check returns err, or logs it and returns nil if errors are to be skipped
+func (opts walkOptions) check(err error) error {
+	if err == nil || !opts.skipErrors {
+		return err
+	}
+	logger.Warn("skipping", "err", err)
+	return nil
+}
+
+// isModuleRoot reports whether dir contains a go.mod file
+func isModuleRoot(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, "go.mod"))
+	return err == nil
+}
+
+// walkTree calls fn for every non-dir entry under the current dir, in lexical order.
+// symlinks to files are reported as the files they point to.
+// every dir is visited at most once, even if several symlinks lead to it,
+// so symlink cycles don't make the walk loop forever.
+func walkTree(opts walkOptions, fn func(p string, entry fs.DirEntry) error) error {
+	return walkDir(opts, ".", fn)
+}
+
+// walkDir is like walkTree, but walks the given dir instead of the current one
+func walkDir(opts walkOptions, root string, fn func(p string, entry fs.DirEntry) error) error {
+	visited := make(map[string]bool)
+	var walk func(dir string) error
+	walk = func(dir string) error {
+		real, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			return opts.check(fmt.Errorf(`could not resolve dir "%s": %w`, dir, err))
+		}
+		real, err = filepath.Abs(real)
+		if err != nil {
+			return opts.check(fmt.Errorf(`could not resolve dir "%s": %w`, dir, err))
+		}
+		if visited[real] {
+			return nil
+		}
+		visited[real] = true
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			err = opts.check(fmt.Errorf(`could not read dir "%s": %w`, dir, err))
+			if err != nil {
+				return err
+			}
+			// ReadDir returns the entries read before the error
+		}
+		for _, entry := range entries {
+			p := filepath.Join(dir, entry.Name())
+			if entry.Type()&fs.ModeSymlink != 0 {
+				info, err := os.Stat(p)
+				if errors.Is(err, fs.ErrNotExist) {
+					// dangling symlink
+					continue
+				}
+				if err != nil {
+					err = opts.check(fmt.Errorf(`could not stat "%s": %w`, p, err))
+					if err != nil {
+						return err
+					}
+					continue
+				}
+				if info.IsDir() && !opts.followSymlinks {
+					continue
+				}
+				entry = fs.FileInfoToDirEntry(info)
+			}
+			if entry.IsDir() {
+				if !opts.workspace && isModuleRoot(p) {
+					continue
+				}
+				err := walk(p)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			err := fn(p, entry)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return walk(root)
+}
+
+// scanTree calls fn with every go test file under the current dir,
+// its package dir, and the fuzz functions in it.
+// cache may be nil, in which case every file is scanned.
+func scanTree(opts walkOptions, cache *discoveryCache, fn func(p string, pkg string, fns []scannedFunc)) error {
+	seen := make(map[string]bool)
+	err := walkTree(opts, func(p string, entry fs.DirEntry) error {
+		if !strings.HasSuffix(p, "_test.go") {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return opts.check(fmt.Errorf(`could not stat file "%s": %w`, p, err))
+		}
+		fns, ok := cache.lookup(p, info)
+		if !ok {
+			fns, err = scanFuzzFuncs(p)
+			if err != nil {
+				return opts.check(err)
+			}
+			cache.store(p, info, fns)
+		}
+		seen[p] = true
+		fn(p, path.Clean(path.Dir(filepath.ToSlash(p))), fns)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	cache.prune(seen)
+	err = cache.save()
+	if err != nil {
+		logger.Warn("could not save discovery cache", "err", err)
+	}
+	return nil
+}
+
+// newFuzz returns the target of the fuzz function fn of the test file at p
+func newFuzz(p string, pkg string, fn scannedFunc) fuzz {
+	return fuzz{
+		fn:       fn.Fn,
+		pkg:      pkg,
+		fullpath: pkg + "/" + fn.Fn,
+		file:     filepath.ToSlash(p),
+		line:     fn.Line,
+		args:     fn.Args,
+		env:      fn.Env,
+		seeds:    fn.Seeds,
+	}
+}
+
+// discover finds fuzz functions in go test files under the current dir
+// whose path matches matchRgx, and sends them to fuzzChan.
+// cache may be nil, in which case every file is scanned.
+func discover(
+	matchRgx *regexp.Regexp,
+	opts walkOptions,
+	cache *discoveryCache,
+	fuzzChan chan<- fuzz,
+) error {
+	return scanTree(opts, cache, func(p string, pkg string, fns []scannedFunc) {
+		for _, fn := range fns {
+			f := newFuzz(p, pkg, fn)
+			if matchRgx.MatchString(f.fullpath) {
+				fuzzChan <- f
+			}
+		}
+	})
+}
+
+// discoverByList is like discover, but takes the fuzz functions of every package
+// that has test files from go test -list, which compiles the tests of the package
+// and so only reports the fuzz functions that its test binary actually has,
+// as decided by build tags and including those that scanning can't find.
+// directives are still read from the test files.
+// args are passed to go test, so that flags such as -tags apply.
+// packages whose tests can't be listed fall back to the fuzz functions found by scanning.
+func discoverByList(
+	matchRgx *regexp.Regexp,
+	opts walkOptions,
+	cache *discoveryCache,
+	args []string,
+	fuzzChan chan<- fuzz,
+) error {
+	var pkgs []string
+	scanned := make(map[string][]fuzz)
+	err := scanTree(opts, cache, func(p string, pkg string, fns []scannedFunc) {
+		if _, ok := scanned[pkg]; !ok {
+			pkgs = append(pkgs, pkg)
+			scanned[pkg] = nil
+		}
+		for _, fn := range fns {
+			scanned[pkg] = append(scanned[pkg], newFuzz(p, pkg, fn))
+		}
+	})
+	if err != nil {
+		return err
+	}
+	for _, pkg := range pkgs {
+		names, err := listFuzzFuncs(pkg, args)
+		targets := scanned[pkg]
+		if err != nil {
+			logger.Warn("falling back to scanning for the fuzz functions", "pkg", pkg, "err", err)
+		} else {
+			targets = listedTargets(pkg, names, scanned[pkg])
+		}
+		for _, f := range targets {
+			if matchRgx.MatchString(f.fullpath) {
+				fuzzChan <- f
+			}
+		}
+	}
+	return nil
+}
+
+// listedTargets returns the targets of the fuzz functions that go test listed in pkg,
+// with the directives and files of those that were also found by scanning
+func listedTargets(pkg string, names []string, scanned []fuzz) []fuzz {
+	byName := make(map[string]fuzz, len(scanned))
+	for _, f := range scanned {
+		byName[f.fn] = f
+	}
+	targets := make([]fuzz, 0, len(names))
+	for _, name := range names {
+		f, ok := byName[name]
+		if !ok {
+			// the file is unknown, but the package dir still attributes it to owners
+			f = fuzz{fn: name, pkg: pkg, fullpath: pkg + "/" + name, file: pkg}
+		}
+		targets = append(targets, f)
+	}
+	return targets
+}
+
+// listFuzzFuncs returns the fuzz functions of the package in the dir pkg,
+// as listed by go test -list
+func listFuzzFuncs(pkg string, args []string) ([]string, error) {
+	cmdArgs := append([]string{"test", "-list=^Fuzz", "./" + pkg}, args...)
+	cmd := exec.Command("go", cmdArgs...)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		// the build errors of the package end up in stdout
+		msg := strings.TrimSpace(stderr.String() + string(out))
+		if strings.Contains(msg, "build constraints exclude all Go files") {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("go test -list failed: %w\n%s", err, msg)
+	}
+	var names []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if fuzzNameRgx.MatchString(line) {
+			names = append(names, line)
+		}
+	}
+	return names, nil
+}
+
+// fuzzNameRgx matches the names of fuzz functions in the output of go test -list
+var fuzzNameRgx = regexp.MustCompile(`^Fuzz\w+$`)
+
+// dedupTargets drops the targets read from targets whose path was already seen,
+// as when files of a package with different build constraints define the same fuzz function,
+// which would otherwise run the same go test command more than once.
+// definitions with different directives are reported, since only the first one is run.
+func dedupTargets(targets <-chan fuzz) <-chan fuzz {
+	out := make(chan fuzz, cap(targets))
+	go func() {
+		defer close(out)
+		seen := make(map[string]fuzz)
+		for f := range targets {
+			first, ok := seen[f.fullpath]
+			if !ok {
+				logger.Debug("discovered target", "target", f.fullpath, "file", f.file, "line", f.line)
+				seen[f.fullpath] = f
+				out <- f
+				continue
+			}
+			if !slices.Equal(first.args, f.args) || !slices.Equal(first.env, f.env) {
+				logger.Warn("target is defined more than once with different directives; only the first is run. rename one of them to run both",
+					"target", f.fullpath, "first", first.file, "other", f.file)
+			}
+		}
+	}()
+	return out
+}
+
+// listing is a target as listed by -list -list-format json
+type listing struct {
+	Target string   `json:"target"`
+	Pkg    string   `json:"pkg"`
+	Func   string   `json:"func"`
+	File   string   `json:"file"`
+	Line   int      `json:"line,omitempty"`
+	Args   []string `json:"args,omitempty"`
+	Env    []string `json:"env,omitempty"`
+	Owners []string `json:"owners,omitempty"`
+	// SeedCount is the number of f.Add calls of the target, and Seeds are the calls
+	SeedCount int          `json:"seed_count"`
+	Seeds     []inlineSeed `json:"seeds"`
+	// CorpusEntries is the number of entries in the seed corpus dir of the target
+	CorpusEntries int `json:"corpus_entries"`
+	// Reach is the number of statements reachable from the fuzz function, if the targets are weighed
+	Reach int `json:"reach,omitempty"`
+}
+
+// listing returns the listing of f
+func (f fuzz) listing() listing {
+	seeds := f.seeds
+	if seeds == nil {
+		seeds = []inlineSeed{}
+	}
+	return listing{
+		Target:        f.fullpath,
+		Pkg:           f.pkg,
+		Func:          f.fn,
+		File:          f.file,
+		Line:          f.line,
+		Args:          f.args,
+		Env:           f.env,
+		Owners:        f.owners,
+		SeedCount:     len(seeds),
+		Seeds:         seeds,
+		CorpusEntries: corpusEntries(f),
+		Reach:         f.reach,
+	}
+}
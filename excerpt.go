@@ -0,0 +1,102 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// failureExcerpt is what matters about a failure in the output of its run,
+// without the fuzzing progress lines and the rest of the noise of go test
+type failureExcerpt struct {
+	// Reason is the panic message, or else the first error reported by the target
+	Reason string `json:"reason,omitempty"`
+	// Input is the encoding of the failing input, as in its corpus file
+	Input string `json:"input,omitempty"`
+	// Fail is the --- FAIL block of the output, which contains the stack trace of a panic
+	Fail string `json:"fail,omitempty"`
+}
+
+// excerpt returns the failure excerpt of r, or nil if r didn't fail
+func (r result) excerpt() *failureExcerpt {
+	if r.sanitized {
+		return r.failure
+	}
+	if r.err == nil || r.cancelled && r.input == "" {
+		return nil
+	}
+	x := &failureExcerpt{
+		Reason: failureReason(r.output),
+		Fail:   failBlock(r.output),
+	}
+	if r.input != "" {
+		// the input is relative to the root dir, which the current dir is
+		data, err := os.ReadFile(filepath.FromSlash(r.input))
+		if err == nil {
+			x.Input = strings.TrimRight(string(data), "\n")
+		}
+	}
+	if *x == (failureExcerpt{}) {
+		return nil
+	}
+	return x
+}
+
+// failBlock returns the --- FAIL block of the output of a failed run, if any,
+// which ends where go test reports the failure of the package
+func failBlock(output string) string {
+	var lines []string
+	for _, line := range strings.Split(output, "\n") {
+		if len(lines) == 0 && !strings.HasPrefix(line, "--- FAIL: ") {
+			continue
+		}
+		if line == "FAIL" || strings.HasPrefix(line, "exit status ") || strings.HasPrefix(line, "FAIL\t") {
+			break
+		}
+		if strings.HasPrefix(line, "fuzz: elapsed: ") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return strings.TrimRight(strings.Join(lines, "\n"), " \t\n")
+}
+
+// crashFrame returns the function that panicked in the output of a failed run, such as example.com/a.Parse,
+// which is the first frame of the stack trace below the frames of the runtime
+func crashFrame(output string) string {
+	panicking := false
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "panic(") {
+			panicking = true
+			continue
+		}
+		// frames are a function line followed by a file line, which begins with the path of the file
+		if !panicking || line == "" || strings.HasPrefix(line, "/") || strings.HasPrefix(line, "runtime.") {
+			continue
+		}
+		i := strings.LastIndex(line, "(")
+		if i <= 0 {
+			continue
+		}
+		return line[:i]
+	}
+	return ""
+}
+
+// failureSignature returns a short hash that identifies the failure of a run,
+// which is the same for the failures that panic in the same function, or else that have the same reason.
+// it's empty if there is neither.
+func failureSignature(output string) string {
+	key := crashFrame(output)
+	if key == "" {
+		key = failureReason(output)
+	}
+	if key == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:6])
+}
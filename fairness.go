@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// starvedRatio is the fraction of its budget, or of its expected share of the machine time,
+// below which a target that didn't fail is considered starved
+const starvedRatio = 0.5
+
+// fairnessEntry is a target in the fairness report
+type fairnessEntry struct {
+	path   string
+	status string
+	// waited is how long the target was queued before it started, and wall is how long it ran
+	waited time.Duration
+	wall   time.Duration
+	// fuzztime is the budget of the target, if known
+	fuzztime time.Duration
+}
+
+// trackStart records when a target started and its budget, for the fairness report
+func (c *consoleReporter) trackStart(e event) {
+	if c.started == nil {
+		c.started = make(map[string]event)
+	}
+	c.started[e.Target] = e
+}
+
+// trackFinish adds the finished target of e to the fairness report
+func (c *consoleReporter) trackFinish(e event) {
+	entry := fairnessEntry{path: e.Target, status: e.Status, wall: e.Duration}
+	if start, ok := c.started[e.Target]; ok {
+		entry.waited = max(start.Time.Sub(c.runStart), 0)
+		entry.fuzztime = fuzztimeDuration(start.Fuzztime)
+	}
+	c.fairness = append(c.fairness, entry)
+}
+
+// printFairness prints the share of the machine time of the run that each target got,
+// against the share it was meant to get according to its -fuzztime,
+// and flags the targets that got much less than they were meant to, which were starved by the scheduler
+func (c *consoleReporter) printFairness() {
+	if len(c.fairness) == 0 {
+		return
+	}
+	var wall, budget time.Duration
+	for _, f := range c.fairness {
+		wall += f.wall
+		budget += f.fuzztime
+	}
+	entries := make([]fairnessEntry, len(c.fairness))
+	copy(entries, c.fairness)
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].path < entries[j].path
+	})
+	header := "===== fairness ====="
+	if c.color {
+		header = paint(header, colorBold)
+	}
+	fmt.Fprintln(c.w, header)
+	var b strings.Builder
+	tw := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "target\twaited\tran\tbudget\tshare\texpected share\t")
+	starved := 0
+	for _, f := range entries {
+		share := percent(f.wall, wall)
+		expected, budgetCell := "-", "-"
+		if f.fuzztime > 0 && budget > 0 {
+			expected = fmt.Sprintf("%.1f%%", percent(f.fuzztime, budget))
+			budgetCell = f.fuzztime.String()
+		}
+		note := ""
+		if f.starved(share, percent(f.fuzztime, budget)) {
+			note = "starved"
+			starved++
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%.1f%%\t%s\t%s\n", f.path, f.waited.Round(time.Millisecond),
+			f.wall.Round(time.Millisecond), budgetCell, share, expected, note)
+	}
+	tw.Flush()
+	fmt.Fprint(c.w, b.String())
+	fmt.Fprintln(c.w)
+	if starved > 0 {
+		fmt.Fprintf(c.w, "%d targets got less than %.0f%% of their budget or of their expected share of the machine time\n\n", starved, starvedRatio*100)
+	}
+}
+
+// starved reports whether the target ran for much less than it was meant to,
+// given its share and expected share of the machine time, in percent.
+// targets that failed, broke or skipped stopped on their own, so they aren't starved.
+func (f fairnessEntry) starved(share float64, expected float64) bool {
+	if f.status != "pass" && f.status != "cancelled" || f.fuzztime <= 0 {
+		return false
+	}
+	return float64(f.wall) < float64(f.fuzztime)*starvedRatio || share < expected*starvedRatio
+}
+
+// percent returns d as a percentage of total
+func percent(d time.Duration, total time.Duration) float64 {
+	if total <= 0 {
+		return 0
+	}
+	return float64(d) / float64(total) * 100
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime/debug"
+	"sync"
+)
+
+// finalizer holds the end-of-run steps, such as finishing the reports
+// and closing the stats shard, and runs them exactly once however the run ends:
+// normally, through die, or by a panic
+type finalizer struct {
+	mu    sync.Mutex
+	steps []func()
+	done  bool
+}
+
+// finalizers are the end-of-run steps of this process
+var finalizers finalizer
+
+// add adds a step, which runs before the steps added before it
+func (f *finalizer) add(step func()) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.steps = append(f.steps, step)
+}
+
+// run runs the steps in reverse order, if they haven't run yet.
+// a panicking step is reported and doesn't keep the rest from running.
+func (f *finalizer) run() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.done {
+		return
+	}
+	f.done = true
+	for i := len(f.steps) - 1; i >= 0; i-- {
+		func() {
+			defer func() {
+				if v := recover(); v != nil {
+					printPanic(v)
+				}
+			}()
+			f.steps[i]()
+		}()
+	}
+}
+
+// printPanic prints a recovered panic value along with the stack trace
+func printPanic(v any) {
+	fmt.Fprintf(os.Stderr, "panic: %v\n\n%s\n", v, debug.Stack())
+}
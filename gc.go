@@ -0,0 +1,195 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const gcHelpText = `Usage: gofuzz gc [OPTIONS...]
+
+gc prunes the runs of the stats DB given by -stats-dir, which are its shards,
+and the saved artifacts of the targets under -artifacts, which are their dirs,
+so that setups that run continuously don't use ever more disk space.
+the oldest ones are removed first. -max-age, -max-count and -max-size
+apply to the runs and the targets separately, and zero means no limit.
+
+Options:
+`
+
+// gcPolicy decides what is kept by gc
+type gcPolicy struct {
+	maxAge   time.Duration
+	maxCount int
+	maxSize  int64
+}
+
+// gcItem is a unit of what gc prunes, such as a stats shard or the artifacts of a target
+type gcItem struct {
+	path    string
+	modTime time.Time
+	size    int64
+}
+
+// prune returns the items that the policy doesn't keep, which are the oldest ones
+func (p gcPolicy) prune(items []gcItem, now time.Time) []gcItem {
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].modTime.After(items[j].modTime)
+	})
+	var removed []gcItem
+	var total int64
+	for i, item := range items {
+		total += item.size
+		switch {
+		case p.maxAge > 0 && now.Sub(item.modTime) > p.maxAge,
+			p.maxCount > 0 && i >= p.maxCount,
+			p.maxSize > 0 && total > p.maxSize:
+			removed = append(removed, item)
+		}
+	}
+	return removed
+}
+
+// shardItems returns the shards of the stats DB
+func (db statsDB) shardItems() ([]gcItem, error) {
+	names, err := db.shards()
+	if err != nil {
+		return nil, err
+	}
+	items := make([]gcItem, 0, len(names))
+	for _, name := range names {
+		p := filepath.Join(db.dir, name)
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, fmt.Errorf(`could not stat stats shard "%s": %w`, p, err)
+		}
+		items = append(items, gcItem{path: p, modTime: info.ModTime(), size: info.Size()})
+	}
+	return items, nil
+}
+
+// artifactItems returns the artifact dirs of the targets under dir,
+// which are those that contain an output.log, dated by the last time it was written
+func artifactItems(dir string) ([]gcItem, error) {
+	var items []gcItem
+	err := filepath.WalkDir(dir, func(p string, entry fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && p == dir {
+			return fs.SkipAll
+		}
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || entry.Name() != "output.log" {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		targetDir := filepath.Dir(p)
+		size, err := dirSize(targetDir)
+		if err != nil {
+			return err
+		}
+		items = append(items, gcItem{path: targetDir, modTime: info.ModTime(), size: size})
+		// the artifacts of a target, such as its corpus, are all in its dir
+		return fs.SkipDir
+	})
+	if err != nil {
+		return nil, fmt.Errorf(`could not walk artifacts dir "%s": %w`, dir, err)
+	}
+	return items, nil
+}
+
+// dirSize returns the total size of the files under dir
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	return size, err
+}
+
+// gcCmd implements the gc subcommand
+func gcCmd(args []string) {
+	flags := flag.NewFlagSet("gc", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, gcHelpText)
+		flags.PrintDefaults()
+	}
+	statsDir := flags.String("stats-dir", "", "stats DB whose runs are pruned")
+	artifactsDir := flags.String("artifacts", "", "artifacts dir whose targets are pruned")
+	maxAge := flags.Duration("max-age", 0, "remove runs and artifacts older than this, such as 720h")
+	maxCount := flags.Int("max-count", 0, "keep at most this many runs, and the artifacts of at most this many targets")
+	maxSizeStr := flags.String("max-size", "", "keep at most this much of runs, and of artifacts, such as 1GiB")
+	dryRun := flags.Bool("n", false, "only print what would be removed")
+	flags.Parse(args)
+	if *statsDir == "" && *artifactsDir == "" {
+		die("-stats-dir or -artifacts is required.")
+	}
+	policy := gcPolicy{maxAge: *maxAge, maxCount: *maxCount}
+	if *maxSizeStr != "" {
+		var err error
+		policy.maxSize, err = parseSize(*maxSizeStr)
+		if err != nil {
+			die(fmt.Errorf("invalid -max-size: %w", err))
+		}
+	}
+	if policy == (gcPolicy{}) {
+		die("at least one of -max-age, -max-count and -max-size is required.")
+	}
+	now := time.Now()
+	prune := func(what string, items []gcItem, remove func(string) error) {
+		var freed int64
+		removed := policy.prune(items, now)
+		for _, item := range removed {
+			fmt.Println(item.path)
+			if *dryRun {
+				continue
+			}
+			err := remove(item.path)
+			if err != nil {
+				die(fmt.Errorf(`could not remove "%s": %w`, item.path, err))
+			}
+			freed += item.size
+		}
+		if !*dryRun {
+			fmt.Fprintf(os.Stderr, "removed %d of %d %s, freeing %d bytes\n", len(removed), len(items), what, freed)
+		}
+	}
+	if *statsDir != "" {
+		items, err := statsDB{dir: *statsDir}.shardItems()
+		if err != nil {
+			die(err)
+		}
+		prune("runs", items, func(p string) error {
+			// the schedule of the run goes along with its shard
+			err := os.Remove(strings.TrimSuffix(p, statsShardExt) + scheduleExt)
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+			return os.Remove(p)
+		})
+	}
+	if *artifactsDir != "" {
+		items, err := artifactItems(*artifactsDir)
+		if err != nil {
+			die(err)
+		}
+		prune("targets' artifacts", items, os.RemoveAll)
+	}
+}
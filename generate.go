@@ -0,0 +1,380 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const genDiffHelpText = `Usage: gofuzz gen-diff [OPTIONS...] -a DIR.Func -b DIR.Func
+
+gen-diff writes a differential fuzz target, which feeds the same input
+to two implementations and fails if their outputs differ.
+DIR is the dir of the package relative to the go project root, as in parser/old.Parse,
+and . for the root package, as in .Parse.
+both functions must be exported and take the same arguments, which must all be
+of a type that go fuzzing supports. if they return an error as their last result,
+the outputs are only compared when neither fails, and otherwise must fail together.
+the target is written to the dir of -a, in the external test package.
+
+Options:
+`
+
+// fuzzableTypes are the argument types that go fuzzing supports,
+// mapped to a seed value of the type
+var fuzzableTypes = map[string]string{
+	"string":  `""`,
+	"[]byte":  `[]byte("")`,
+	"bool":    `false`,
+	"byte":    `byte(0)`,
+	"rune":    `rune(0)`,
+	"int":     `int(0)`,
+	"int8":    `int8(0)`,
+	"int16":   `int16(0)`,
+	"int32":   `int32(0)`,
+	"int64":   `int64(0)`,
+	"uint":    `uint(0)`,
+	"uint8":   `uint8(0)`,
+	"uint16":  `uint16(0)`,
+	"uint32":  `uint32(0)`,
+	"uint64":  `uint64(0)`,
+	"float32": `float32(0)`,
+	"float64": `float64(0)`,
+}
+
+// genFunc is a function that generated fuzz targets call
+type genFunc struct {
+	// dir is the dir of the package, relative to the project root
+	dir     string
+	pkg     string
+	name    string
+	params  []string
+	results []string
+}
+
+// importPath returns the import path of the package of fn
+// in the module with the given path
+func (fn genFunc) importPath(modPath string) string {
+	if fn.dir == "." {
+		return modPath
+	}
+	return modPath + "/" + fn.dir
+}
+
+// returnsError reports whether the last result of fn is an error
+func (fn genFunc) returnsError() bool {
+	return len(fn.results) > 0 && fn.results[len(fn.results)-1] == "error"
+}
+
+// fieldTypes returns the type of every value in a field list,
+// repeating the type of fields that declare several names
+func fieldTypes(fields *ast.FieldList) []string {
+	if fields == nil {
+		return nil
+	}
+	var out []string
+	for _, field := range fields.List {
+		typ := types.ExprString(field.Type)
+		for range max(len(field.Names), 1) {
+			out = append(out, typ)
+		}
+	}
+	return out
+}
+
+// packageFiles parses the non-test go files in dir
+func packageFiles(dir string) ([]*ast.File, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+	var files []*ast.File
+	for _, p := range paths {
+		if strings.HasSuffix(p, "_test.go") {
+			continue
+		}
+		file, err := parser.ParseFile(token.NewFileSet(), p, nil, parser.SkipObjectResolution)
+		if err != nil {
+			return nil, fmt.Errorf(`could not parse "%s": %w`, p, err)
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// loadGenFunc finds the function given as DIR.Func
+func loadGenFunc(spec string) (genFunc, error) {
+	i := strings.LastIndex(spec, ".")
+	if i < 0 || strings.Contains(spec[i:], "/") {
+		return genFunc{}, fmt.Errorf(`invalid function "%s": expected DIR.Func`, spec)
+	}
+	fn := genFunc{
+		dir:  path.Clean(strings.TrimPrefix(spec[:i], "./")),
+		name: spec[i+1:],
+	}
+	if fn.dir == "" {
+		fn.dir = "."
+	}
+	if !token.IsExported(fn.name) {
+		return genFunc{}, fmt.Errorf(`function "%s" is not exported`, spec)
+	}
+	files, err := packageFiles(filepath.FromSlash(fn.dir))
+	if err != nil {
+		return genFunc{}, err
+	}
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			d, ok := decl.(*ast.FuncDecl)
+			if !ok || d.Recv != nil || d.Name.Name != fn.name || d.Type.TypeParams != nil {
+				continue
+			}
+			fn.pkg = file.Name.Name
+			fn.params = fieldTypes(d.Type.Params)
+			fn.results = fieldTypes(d.Type.Results)
+			return fn, nil
+		}
+	}
+	return genFunc{}, fmt.Errorf(`function "%s" not found`, spec)
+}
+
+// checkFuzzable returns an error if fn takes no arguments,
+// or arguments that go fuzzing doesn't support
+func checkFuzzable(fn genFunc) error {
+	if len(fn.params) == 0 {
+		return fmt.Errorf("%s.%s takes no arguments", fn.pkg, fn.name)
+	}
+	for _, typ := range fn.params {
+		if _, ok := fuzzableTypes[typ]; !ok {
+			return fmt.Errorf("%s.%s takes a %s, which go fuzzing does not support", fn.pkg, fn.name, typ)
+		}
+	}
+	return nil
+}
+
+// importNames returns the names to import the packages of fns as,
+// which are their package names unless those conflict.
+// functions in the same package share a name.
+func importNames(fns ...genFunc) []string {
+	names := make([]string, len(fns))
+	count := make(map[string]map[string]bool)
+	for _, fn := range fns {
+		if count[fn.pkg] == nil {
+			count[fn.pkg] = make(map[string]bool)
+		}
+		count[fn.pkg][fn.dir] = true
+	}
+	byDir := make(map[string]string)
+	for i, fn := range fns {
+		if name, ok := byDir[fn.dir]; ok {
+			names[i] = name
+			continue
+		}
+		names[i] = fn.pkg
+		if len(count[fn.pkg]) > 1 {
+			names[i] = fmt.Sprintf("%s%d", fn.pkg, len(byDir)+1)
+		}
+		byDir[fn.dir] = names[i]
+	}
+	return names
+}
+
+// writeGenerated formats src and writes it to the new file at p
+func writeGenerated(p string, src string) error {
+	formatted, err := format.Source([]byte(src))
+	if err != nil {
+		return fmt.Errorf("could not format the generated code: %w", err)
+	}
+	file, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if errors.Is(err, fs.ErrExist) {
+		return fmt.Errorf(`not overwriting "%s"`, p)
+	}
+	if err != nil {
+		return fmt.Errorf(`could not create "%s": %w`, p, err)
+	}
+	_, err = file.Write(formatted)
+	if err == nil {
+		err = file.Close()
+	}
+	if err != nil {
+		return fmt.Errorf(`could not write "%s": %w`, p, err)
+	}
+	return nil
+}
+
+// diffTarget returns the source of a differential fuzz target named name,
+// in the external test package of a
+func diffTarget(modPath, name string, a, b genFunc) string {
+	names := importNames(a, b)
+	var src strings.Builder
+	fmt.Fprintln(&src, "// Code generated by gofuzz gen-diff.")
+	fmt.Fprintln(&src)
+	fmt.Fprintf(&src, "package %s_test\n\n", a.pkg)
+	fmt.Fprintln(&src, "import (")
+	fmt.Fprintln(&src, `"reflect"`)
+	fmt.Fprintln(&src, `"testing"`)
+	fmt.Fprintln(&src)
+	fmt.Fprintf(&src, "%s %q\n", names[0], a.importPath(modPath))
+	if names[1] != names[0] {
+		fmt.Fprintf(&src, "%s %q\n", names[1], b.importPath(modPath))
+	}
+	fmt.Fprintln(&src, ")")
+	fmt.Fprintln(&src)
+
+	var args, params, seeds []string
+	for i, typ := range a.params {
+		arg := fmt.Sprintf("in%d", i)
+		args = append(args, arg)
+		params = append(params, arg+" "+typ)
+		seeds = append(seeds, fuzzableTypes[typ])
+	}
+	var gotA, gotB []string
+	for i := range a.results {
+		gotA = append(gotA, fmt.Sprintf("a%d", i))
+		gotB = append(gotB, fmt.Sprintf("b%d", i))
+	}
+	call := func(got []string, name string, fn genFunc) {
+		if len(got) > 0 {
+			fmt.Fprintf(&src, "%s := ", strings.Join(got, ", "))
+		}
+		fmt.Fprintf(&src, "%s.%s(%s)\n", name, fn.name, strings.Join(args, ", "))
+	}
+
+	fmt.Fprintf(&src, "// %s checks that %s.%s and %s.%s agree on every input\n",
+		name, names[0], a.name, names[1], b.name)
+	fmt.Fprintf(&src, "func %s(f *testing.F) {\n", name)
+	fmt.Fprintf(&src, "f.Add(%s)\n", strings.Join(seeds, ", "))
+	fmt.Fprintf(&src, "f.Fuzz(func(t *testing.T, %s) {\n", strings.Join(params, ", "))
+	call(gotA, names[0], a)
+	call(gotB, names[1], b)
+	outA, outB := gotA, gotB
+	if a.returnsError() {
+		errA, errB := gotA[len(gotA)-1], gotB[len(gotB)-1]
+		outA, outB = gotA[:len(gotA)-1], gotB[:len(gotB)-1]
+		fmt.Fprintf(&src, "if (%s == nil) != (%s == nil) {\n", errA, errB)
+		fmt.Fprintf(&src, "t.Fatalf(\"errors differ:\\na: %%v\\nb: %%v\", %s, %s)\n", errA, errB)
+		fmt.Fprintln(&src, "}")
+		if len(outA) > 0 {
+			fmt.Fprintf(&src, "if %s != nil {\nreturn\n}\n", errA)
+		}
+	}
+	for i := range outA {
+		fmt.Fprintf(&src, "if !reflect.DeepEqual(%s, %s) {\n", outA[i], outB[i])
+		fmt.Fprintf(&src, "t.Fatalf(\"outputs differ:\\na: %%#v\\nb: %%#v\", %s, %s)\n", outA[i], outB[i])
+		fmt.Fprintln(&src, "}")
+	}
+	fmt.Fprintln(&src, "})")
+	fmt.Fprintln(&src, "}")
+	return src.String()
+}
+
+// genDiffCmd implements the gen-diff subcommand
+func genDiffCmd(args []string) {
+	flags := flag.NewFlagSet("gen-diff", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, genDiffHelpText)
+		flags.PrintDefaults()
+	}
+	root := flags.String("root", ".", "root dir of the go project")
+	specA := flags.String("a", "", "first implementation, as DIR.Func")
+	specB := flags.String("b", "", "second implementation, as DIR.Func")
+	name := flags.String("name", "", "name of the fuzz target (default FuzzDiff followed by the function names)")
+	seeds := flags.String("seeds", "", "existing target, as in path/to/package/FuzzFuncName, whose corpus is copied to the new target")
+	flags.Parse(args)
+	if *specA == "" || *specB == "" || flags.NArg() != 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	err := os.Chdir(*root)
+	if err != nil {
+		die(err)
+	}
+	modPath := readModulePath(".")
+	if modPath == "" {
+		die("no module path found in go.mod.")
+	}
+	a, err := loadGenFunc(*specA)
+	if err != nil {
+		die(err)
+	}
+	b, err := loadGenFunc(*specB)
+	if err != nil {
+		die(err)
+	}
+	err = checkFuzzable(a)
+	if err != nil {
+		die(err)
+	}
+	if strings.Join(a.params, ",") != strings.Join(b.params, ",") {
+		die(fmt.Errorf("%s and %s take different arguments", *specA, *specB))
+	}
+	if len(a.results) != len(b.results) || a.returnsError() != b.returnsError() {
+		die(fmt.Errorf("%s and %s return different results", *specA, *specB))
+	}
+	if len(a.results) == 0 {
+		die(fmt.Errorf("%s returns nothing to compare", *specA))
+	}
+	if *name == "" {
+		*name = "FuzzDiff" + a.name
+		if b.name != a.name {
+			*name += b.name
+		}
+	}
+	if !fuzzRgx.MatchString("func " + *name) {
+		die(fmt.Errorf(`invalid target name "%s"`, *name))
+	}
+	dir := filepath.FromSlash(a.dir)
+	p := filepath.Join(dir, strings.ToLower(*name)+"_test.go")
+	err = writeGenerated(p, diffTarget(modPath, *name, a, b))
+	if err != nil {
+		die(err)
+	}
+	fmt.Printf("wrote %s\n", p)
+	if *seeds != "" {
+		n, err := copySeeds(*seeds, filepath.Join(dir, "testdata", "fuzz", *name))
+		if err != nil {
+			die(err)
+		}
+		fmt.Printf("copied %d seeds from %s\n", n, *seeds)
+	}
+}
+
+// copySeeds copies the seed corpus of the given target into dst
+func copySeeds(target string, dst string) (int, error) {
+	pkg, fn := path.Split(path.Clean(target))
+	src := filepath.Join(filepath.FromSlash(path.Clean(pkg)), "testdata", "fuzz", fn)
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return 0, fmt.Errorf(`could not read corpus dir "%s": %w`, src, err)
+	}
+	err = os.MkdirAll(dst, 0o755)
+	if err != nil {
+		return 0, fmt.Errorf(`could not create corpus dir "%s": %w`, dst, err)
+	}
+	n := 0
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(src, entry.Name()))
+		if err != nil {
+			return n, fmt.Errorf(`could not read corpus entry "%s": %w`, entry.Name(), err)
+		}
+		p := filepath.Join(dst, entry.Name())
+		err = os.WriteFile(p, data, 0o644)
+		if err != nil {
+			return n, fmt.Errorf(`could not write corpus entry "%s": %w`, p, err)
+		}
+		n++
+	}
+	return n, nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// githubReporter emits github actions workflow commands,
+// so that problematic targets show up as annotations of the workflow run
+type githubReporter struct {
+	w io.Writer
+	// dir is the path of -root relative to the root of the repository,
+	// which the paths of annotations are relative to. it's found with the first annotation.
+	dir      string
+	dirFound bool
+}
+
+func (g *githubReporter) report(e event) error {
+	if e.Type == eventRunEnd && e.Status == "cancelled" {
+		g.command("warning", "", "gofuzz: run cancelled", e.Error+"\nthe results are partial")
+	}
+	if e.Type != eventTargetFinish {
+		return nil
+	}
+	var owners string
+	if len(e.Owners) > 0 {
+		owners = "\nowners: " + strings.Join(e.Owners, " ")
+	}
+	// annotate the fuzz function, so that the annotation shows up in pull request diffs
+	var loc string
+	if r := e.result; r != nil && r.file != "" && r.line > 0 {
+		if !g.dirFound {
+			g.dir, g.dirFound = repoDir(), true
+		}
+		file := path.Join(g.dir, filepath.ToSlash(r.file))
+		loc = fmt.Sprintf("file=%s,line=%d,", githubEscapeProperty(file), r.line)
+	}
+	switch e.Status {
+	case "fail":
+		msg := "fuzzing failed"
+		if e.Excerpt != nil && e.Excerpt.Reason != "" {
+			msg += ": " + e.Excerpt.Reason
+		}
+		if e.Input != "" {
+			msg += "\nfailing input: " + e.Input
+		}
+		g.command("error", loc, "gofuzz: "+e.Target+" failed", msg+owners)
+	case "broken":
+		g.command("error", loc, "gofuzz: "+e.Target+" is broken", "the target failed to build or to pass its seed corpus"+owners)
+	case "skip":
+		g.command("warning", loc, "gofuzz: "+e.Target+" was not fuzzed", "the target skipped instead of fuzzing"+owners)
+	}
+	return nil
+}
+
+// repoDir returns the path of the working dir, which is -root, relative to the root of the repository:
+// $GITHUB_WORKSPACE if it's set, or else the top level of the git work tree.
+// it returns "" if the working dir is the root, or isn't under it.
+func repoDir() string {
+	top := os.Getenv("GITHUB_WORKSPACE")
+	if top == "" {
+		out, err := exec.Command("git", "rev-parse", "--show-toplevel").Output()
+		if err != nil {
+			return ""
+		}
+		top = strings.TrimSpace(string(out))
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	// either may be reached through a symlink
+	if p, err := filepath.EvalSymlinks(top); err == nil {
+		top = p
+	}
+	if p, err := filepath.EvalSymlinks(wd); err == nil {
+		wd = p
+	}
+	rel, err := filepath.Rel(top, wd)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return ""
+	}
+	return filepath.ToSlash(rel)
+}
+
+// command prints a workflow command.
+// loc is either empty or the file and line properties followed by a comma.
+func (g *githubReporter) command(name string, loc string, title string, msg string) {
+	fmt.Fprintf(g.w, "::%s %stitle=%s::%s\n", name, loc, githubEscapeProperty(title), githubEscapeData(msg))
+}
+
+// githubEscapeData escapes the message of a workflow command
+func githubEscapeData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+// githubEscapeProperty escapes a property value of a workflow command
+func githubEscapeProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
+
+func (g *githubReporter) close() error {
+	return nil
+}
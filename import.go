@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	// headerRgx matches the headers gofuzz prints before each result
+	headerRgx = regexp.MustCompile(`^===== (.+) =====$`)
+
+	// runRgx matches the line go test -v prints when a test starts
+	runRgx = regexp.MustCompile(`^=== RUN\s+(Fuzz\w+)$`)
+
+	// verdictRgx matches the line go test prints when a top-level test finishes
+	verdictRgx = regexp.MustCompile(`^--- (PASS|FAIL|SKIP): (Fuzz\w+) \(([0-9.]+s)\)`)
+
+	// pkgVerdictRgx matches the line go test prints when a package finishes
+	pkgVerdictRgx = regexp.MustCompile(`^(ok|FAIL)\s+(\S+)\s+([0-9.]+s)`)
+)
+
+// importedResult is a fuzzing result recovered from a go test log
+type importedResult struct {
+	fn       string
+	pkg      string
+	status   string
+	duration time.Duration
+}
+
+// logParser recovers fuzzing results from the saved output of
+// gofuzz or of plain go test -fuzz runs
+type logParser struct {
+	modPath   string
+	defaultFn string
+	cur       importedResult
+	results   []importedResult
+}
+
+// flush records the current result if it is complete enough to be useful
+func (p *logParser) flush() {
+	if p.cur.fn == "" {
+		p.cur.fn = p.defaultFn
+	}
+	if p.cur.fn != "" && p.cur.pkg != "" && p.cur.status != "" {
+		p.results = append(p.results, p.cur)
+	}
+	p.cur = importedResult{}
+}
+
+// relPkg converts an import path to a package path relative to the module root
+func (p *logParser) relPkg(importPath string) string {
+	if importPath == p.modPath {
+		return "."
+	}
+	if p.modPath != "" && strings.HasPrefix(importPath, p.modPath+"/") {
+		return strings.TrimPrefix(importPath, p.modPath+"/")
+	}
+	return importPath
+}
+
+// parseLine consumes one line of the log
+func (p *logParser) parseLine(line string) error {
+	if m := headerRgx.FindStringSubmatch(line); m != nil {
+		p.flush()
+		fullpath := m[1]
+		fn := path.Base(fullpath)
+		if strings.HasPrefix(fn, "Fuzz") && !strings.Contains(fullpath, "/testdata/") {
+			p.cur.fn = fn
+			p.cur.pkg = path.Dir(fullpath)
+		}
+		return nil
+	}
+	if m := runRgx.FindStringSubmatch(line); m != nil {
+		p.cur.fn = m[1]
+		return nil
+	}
+	if m := verdictRgx.FindStringSubmatch(line); m != nil {
+		d, err := time.ParseDuration(m[3])
+		if err != nil {
+			return err
+		}
+		p.cur.fn = m[2]
+		p.cur.status = strings.ToLower(m[1])
+		p.cur.duration = d
+		return nil
+	}
+	if m := pkgVerdictRgx.FindStringSubmatch(line); m != nil {
+		if p.cur.pkg == "" {
+			p.cur.pkg = p.relPkg(m[2])
+		}
+		if p.cur.status == "" {
+			p.cur.status = "pass"
+			if m[1] == "FAIL" {
+				p.cur.status = "fail"
+			}
+		}
+		if p.cur.duration == 0 {
+			d, err := time.ParseDuration(m[3])
+			if err != nil {
+				return err
+			}
+			p.cur.duration = d
+		}
+		// a gofuzz block ends at the next header, but plain go test logs
+		// may contain several packages one after another
+		if p.cur.fn != "" {
+			p.flush()
+		}
+	}
+	return nil
+}
+
+// readModulePath returns the module path declared in the go.mod in dir,
+// or an empty string if there is none
+func readModulePath(dir string) string {
+	data, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "module" {
+			return strings.Trim(fields[1], `"`)
+		}
+	}
+	return ""
+}
+
+// importLog parses the log file at p and writes the recovered results
+// into a new shard of db. the shard is named after the log's content,
+// so importing the same log twice is an error rather than a duplicate.
+// defaultFn is used for results whose fuzz function the log doesn't mention,
+// which is the case for passing targets in non-verbose go test output.
+func importLog(db statsDB, p string, modPath string, defaultFn string) (int, error) {
+	file, err := os.Open(p)
+	if err != nil {
+		return 0, fmt.Errorf(`could not open log "%s": %w`, p, err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return 0, fmt.Errorf(`could not stat log "%s": %w`, p, err)
+	}
+	hash := sha256.New()
+	parser := logParser{modPath: modPath, defaultFn: defaultFn}
+	sc := bufio.NewScanner(io.TeeReader(file, hash))
+	sc.Buffer(nil, 1024*1024)
+	for sc.Scan() {
+		err := parser.parseLine(sc.Text())
+		if err != nil {
+			return 0, fmt.Errorf(`could not parse log "%s": %w`, p, err)
+		}
+	}
+	err = sc.Err()
+	if err != nil {
+		return 0, fmt.Errorf(`could not scan log "%s": %w`, p, err)
+	}
+	parser.flush()
+	if len(parser.results) == 0 {
+		return 0, nil
+	}
+
+	// the log carries no timestamps, so the results are laid out
+	// back to back, ending at the time the log was last written
+	run := "import-" + hex.EncodeToString(hash.Sum(nil))[:16]
+	shard, err := db.openShard(run)
+	if err != nil {
+		return 0, err
+	}
+	defer shard.close()
+	end := info.ModTime()
+	for i := len(parser.results) - 1; i >= 0; i-- {
+		r := parser.results[i]
+		start := end.Add(-r.duration)
+		err := shard.write(statsRecord{
+			Target:   r.pkg + "/" + r.fn,
+			Start:    start,
+			Duration: r.duration,
+			Status:   r.status,
+		})
+		if err != nil {
+			return 0, err
+		}
+		end = start
+	}
+	return len(parser.results), nil
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// junitTestsuites is the root element of a junit xml report
+type junitTestsuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     float64          `xml:"time,attr"`
+	Suites   []junitTestsuite `xml:"testsuite"`
+}
+
+// junitTestsuite contains the testcases of a single package
+type junitTestsuite struct {
+	Name       string           `xml:"name,attr"`
+	Tests      int              `xml:"tests,attr"`
+	Failures   int              `xml:"failures,attr"`
+	Errors     int              `xml:"errors,attr"`
+	Skipped    int              `xml:"skipped,attr"`
+	Time       float64          `xml:"time,attr"`
+	Timestamp  string           `xml:"timestamp,attr"`
+	Properties *junitProperties `xml:"properties,omitempty"`
+	Cases      []junitTestcase  `xml:"testcase"`
+}
+
+// junitTestcase is the result of a single fuzz target
+type junitTestcase struct {
+	Classname  string           `xml:"classname,attr"`
+	Name       string           `xml:"name,attr"`
+	Time       float64          `xml:"time,attr"`
+	Properties *junitProperties `xml:"properties,omitempty"`
+	Failure    *junitMessage    `xml:"failure,omitempty"`
+	Error      *junitMessage    `xml:"error,omitempty"`
+	Skipped    *junitMessage    `xml:"skipped,omitempty"`
+	SystemOut  string           `xml:"system-out,omitempty"`
+}
+
+// junitProperties is the properties element of a testsuite or testcase,
+// which is left out if there are none
+type junitProperties struct {
+	Property []junitProperty `xml:"property"`
+}
+
+// junitProperty is a name-value pair of a testsuite or testcase,
+// such as a label of the run or an owner of the target
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+// junitMessage is the failure, error or skip reason of a testcase
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr,omitempty"`
+	Body    string `xml:",chardata"`
+}
+
+// junitReporter writes a junit xml report at the end of the run,
+// with a testsuite per package and a testcase per target
+type junitReporter struct {
+	w       io.WriteCloser
+	start   time.Time
+	results []result
+	// props are the note and labels of the run, set on every testsuite
+	props *junitProperties
+}
+
+func (j *junitReporter) report(e event) error {
+	switch e.Type {
+	case eventRunStart:
+		j.start = e.Time
+		var props []junitProperty
+		if e.Note != "" {
+			props = append(props, junitProperty{Name: "note", Value: e.Note})
+		}
+		keys := make([]string, 0, len(e.Labels))
+		for k := range e.Labels {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			props = append(props, junitProperty{Name: k, Value: e.Labels[k]})
+		}
+		if len(props) > 0 {
+			j.props = &junitProperties{Property: props}
+		}
+	case eventTargetFinish:
+		j.results = append(j.results, *e.result)
+	case eventRunEnd:
+		return j.write(e.Time.Sub(j.start))
+	}
+	return nil
+}
+
+// write writes the report
+func (j *junitReporter) write(elapsed time.Duration) error {
+	root := junitTestsuites{Name: "gofuzz", Time: elapsed.Seconds()}
+	suites := make(map[string]*junitTestsuite)
+	for _, r := range j.results {
+		suite, ok := suites[r.pkg]
+		if !ok {
+			suite = &junitTestsuite{
+				Name:       r.pkg,
+				Timestamp:  r.start.UTC().Format("2006-01-02T15:04:05"),
+				Properties: j.props,
+			}
+			suites[r.pkg] = suite
+		}
+		tc := junitTestcase{
+			Classname: r.pkg,
+			Name:      r.fn,
+			Time:      r.duration.Seconds(),
+			SystemOut: r.output,
+		}
+		// testcases have no timestamps in the junit schema, so they are properties
+		tc.Properties = &junitProperties{Property: []junitProperty{
+			{Name: "start", Value: r.start.Format(time.RFC3339Nano)},
+			{Name: "end", Value: r.end().Format(time.RFC3339Nano)},
+		}}
+		for _, owner := range r.owners {
+			tc.Properties.Property = append(tc.Properties.Property, junitProperty{Name: "owner", Value: owner})
+		}
+		if r.withheld {
+			tc.Properties.Property = append(tc.Properties.Property, junitProperty{Name: "withheld", Value: "possible secrets were withheld from the output"})
+		}
+		switch r.status() {
+		case "fail":
+			msg := "fuzzing failed"
+			if r.input != "" {
+				msg += ", failing input: " + r.input
+			}
+			tc.Failure = &junitMessage{Message: msg, Type: "fuzz"}
+			if x := r.excerpt(); x != nil {
+				tc.Failure.Body = x.Fail
+			}
+			suite.Failures++
+		case "broken":
+			tc.Error = &junitMessage{Message: "failed to build or to pass its seed corpus", Type: "broken"}
+			suite.Errors++
+		case "skip":
+			tc.Skipped = &junitMessage{Message: r.skipMessage()}
+			suite.Skipped++
+		case "cancelled":
+			tc.Skipped = &junitMessage{Message: "cancelled"}
+			suite.Skipped++
+		}
+		suite.Tests++
+		suite.Time += r.duration.Seconds()
+		suite.Cases = append(suite.Cases, tc)
+	}
+	names := make([]string, 0, len(suites))
+	for name := range suites {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		suite := suites[name]
+		root.Tests += suite.Tests
+		root.Failures += suite.Failures
+		root.Errors += suite.Errors
+		root.Skipped += suite.Skipped
+		root.Suites = append(root.Suites, *suite)
+	}
+	_, err := io.WriteString(j.w, xml.Header)
+	if err != nil {
+		return fmt.Errorf("could not write junit report: %w", err)
+	}
+	enc := xml.NewEncoder(j.w)
+	enc.Indent("", "  ")
+	err = enc.Encode(root)
+	if err != nil {
+		return fmt.Errorf("could not write junit report: %w", err)
+	}
+	_, err = io.WriteString(j.w, "\n")
+	return err
+}
+
+func (j *junitReporter) close() error {
+	return j.w.Close()
+}
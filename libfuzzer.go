@@ -0,0 +1,295 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const wrapLibfuzzerHelpText = `Usage: gofuzz wrap-libfuzzer [OPTIONS...] TARGET
+
+wrap-libfuzzer generates a libFuzzer harness for TARGET, which is given
+as path/to/package/FuzzFuncName, as printed by gofuzz list.
+the fuzz function of the target must be a literal taking a single []byte argument.
+it is copied into a file that defines LLVMFuzzerTestOneInput,
+with its *testing.T replaced by a stand-in whose failures crash the harness.
+the file is only built with the libfuzzer_FuzzFuncName build tag.
+variables of the enclosing function and test-only helpers are not copied,
+so fuzz functions that use them have to be adjusted by hand.
+
+Options:
+`
+
+// libfuzzerTemplate is the harness that wrap-libfuzzer generates.
+// the verbs are the build tag, the package name, the imports,
+// the target name, the parameters and the body of the fuzz function.
+const libfuzzerTemplate = `// Code generated by gofuzz wrap-libfuzzer. DO NOT EDIT.
+
+//go:build %s
+
+package %s
+
+import "C"
+
+import (
+	"fmt"
+	"os"
+	"unsafe"
+%s)
+
+//export LLVMFuzzerTestOneInput
+func LLVMFuzzerTestOneInput(data *C.char, size C.size_t) C.int {
+	t := &libfuzzerT{name: %q}
+	t.run(func() {
+		libfuzzerFunc(t, C.GoBytes(unsafe.Pointer(data), C.int(size)))
+	})
+	return 0
+}
+
+var libfuzzerFunc = func(%s *libfuzzerT, %s []byte) %s
+
+// libfuzzerT stands in for the *testing.T of the fuzz function.
+// a failed input panics, which libFuzzer reports as a crash.
+type libfuzzerT struct {
+	name     string
+	failed   bool
+	skipped  bool
+	cleanups []func()
+}
+
+// libfuzzerStop is the panic value that stops the fuzz function early
+type libfuzzerStop struct{}
+
+func (t *libfuzzerT) run(fn func()) {
+	defer func() {
+		r := recover()
+		for i := len(t.cleanups) - 1; i >= 0; i-- {
+			t.cleanups[i]()
+		}
+		if _, ok := r.(libfuzzerStop); r != nil && !ok {
+			panic(r)
+		}
+		if t.failed {
+			panic(t.name + " failed")
+		}
+	}()
+	fn()
+}
+
+func (t *libfuzzerT) Name() string          { return t.name }
+func (t *libfuzzerT) Helper()               {}
+func (t *libfuzzerT) Cleanup(fn func())     { t.cleanups = append(t.cleanups, fn) }
+func (t *libfuzzerT) Log(args ...any)       { fmt.Fprintln(os.Stderr, args...) }
+func (t *libfuzzerT) Logf(f string, a ...any) { fmt.Fprintf(os.Stderr, f+"\n", a...) }
+func (t *libfuzzerT) Fail()                 { t.failed = true }
+func (t *libfuzzerT) Failed() bool          { return t.failed }
+func (t *libfuzzerT) FailNow()              { t.failed = true; panic(libfuzzerStop{}) }
+func (t *libfuzzerT) Error(args ...any)     { t.Log(args...); t.Fail() }
+func (t *libfuzzerT) Errorf(f string, a ...any) { t.Logf(f, a...); t.Fail() }
+func (t *libfuzzerT) Fatal(args ...any)     { t.Log(args...); t.FailNow() }
+func (t *libfuzzerT) Fatalf(f string, a ...any) { t.Logf(f, a...); t.FailNow() }
+func (t *libfuzzerT) SkipNow()              { t.skipped = true; panic(libfuzzerStop{}) }
+func (t *libfuzzerT) Skip(args ...any)      { t.Log(args...); t.SkipNow() }
+func (t *libfuzzerT) Skipf(f string, a ...any) { t.Logf(f, a...); t.SkipNow() }
+func (t *libfuzzerT) Skipped() bool         { return t.skipped }
+`
+
+// harnessImports are the imports of the harness itself
+var harnessImports = map[string]bool{"C": true, "fmt": true, "os": true, "unsafe": true}
+
+// versionRgx matches the major version suffix of import paths
+var versionRgx = regexp.MustCompile(`^v[0-9]+$`)
+
+// importName returns the name that the given import spec is referred to by
+func importName(spec *ast.ImportSpec) string {
+	if spec.Name != nil {
+		return spec.Name.Name
+	}
+	p, _ := strconv.Unquote(spec.Path.Value)
+	name := path.Base(p)
+	if versionRgx.MatchString(name) && path.Dir(p) != "." {
+		name = path.Base(path.Dir(p))
+	}
+	return name
+}
+
+// fieldName returns the name of a func literal parameter, or _ if it has none
+func fieldName(field *ast.Field) string {
+	if len(field.Names) == 0 {
+		return "_"
+	}
+	return field.Names[0].Name
+}
+
+// findFuzzLiteral returns the fuzz function literal passed to f.Fuzz
+// in the fuzz function named fn in file
+func findFuzzLiteral(file *ast.File, fn string) (*ast.FuncLit, error) {
+	for _, decl := range file.Decls {
+		d, ok := decl.(*ast.FuncDecl)
+		if !ok || d.Name.Name != fn || d.Recv != nil || d.Body == nil {
+			continue
+		}
+		var lit *ast.FuncLit
+		ast.Inspect(d.Body, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok || lit != nil {
+				return lit == nil
+			}
+			sel, ok := call.Fun.(*ast.SelectorExpr)
+			if !ok || sel.Sel.Name != "Fuzz" || len(call.Args) != 1 {
+				return true
+			}
+			lit, _ = call.Args[0].(*ast.FuncLit)
+			return lit == nil
+		})
+		if lit == nil {
+			return nil, fmt.Errorf("%s does not pass a func literal to f.Fuzz", fn)
+		}
+		return lit, nil
+	}
+	return nil, nil
+}
+
+// isBytesParam reports whether the params of a fuzz function literal
+// are a *testing.T and a single []byte
+func isBytesParam(lit *ast.FuncLit) bool {
+	params := lit.Type.Params.List
+	if len(params) != 2 || len(params[0].Names) > 1 || len(params[1].Names) > 1 {
+		return false
+	}
+	arr, ok := params[1].Type.(*ast.ArrayType)
+	if !ok || arr.Len != nil {
+		return false
+	}
+	elem, ok := arr.Elt.(*ast.Ident)
+	return ok && elem.Name == "byte"
+}
+
+// libfuzzerHarness returns the source of the libFuzzer harness of the target
+// whose fuzz function is fn in the package in dir
+func libfuzzerHarness(dir, fn string) ([]byte, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*_test.go"))
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range paths {
+		src, err := os.ReadFile(p)
+		if err != nil {
+			return nil, fmt.Errorf(`could not read "%s": %w`, p, err)
+		}
+		fset := token.NewFileSet()
+		file, err := parser.ParseFile(fset, p, src, parser.SkipObjectResolution)
+		if err != nil {
+			return nil, fmt.Errorf(`could not parse "%s": %w`, p, err)
+		}
+		lit, err := findFuzzLiteral(file, fn)
+		if err != nil {
+			return nil, err
+		}
+		if lit == nil {
+			continue
+		}
+		if !isBytesParam(lit) {
+			return nil, fmt.Errorf("the fuzz function of %s does not take a single []byte argument", fn)
+		}
+		if strings.HasSuffix(file.Name.Name, "_test") {
+			return nil, fmt.Errorf(`%s is in the external test package "%s"`, fn, file.Name.Name)
+		}
+
+		// keep the imports that the literal refers to
+		used := make(map[string]bool)
+		ast.Inspect(lit.Body, func(n ast.Node) bool {
+			if sel, ok := n.(*ast.SelectorExpr); ok {
+				if id, ok := sel.X.(*ast.Ident); ok {
+					used[id.Name] = true
+				}
+			}
+			return true
+		})
+		var imports []string
+		for _, spec := range file.Imports {
+			name := importName(spec)
+			p, _ := strconv.Unquote(spec.Path.Value)
+			if !used[name] || harnessImports[p] {
+				continue
+			}
+			if spec.Name != nil {
+				imports = append(imports, fmt.Sprintf("\t%s %s\n", spec.Name.Name, spec.Path.Value))
+			} else {
+				imports = append(imports, fmt.Sprintf("\t%s\n", spec.Path.Value))
+			}
+		}
+		sort.Strings(imports)
+
+		params := lit.Type.Params.List
+		tName, dataName := fieldName(params[0]), fieldName(params[1])
+		body := src[fset.Position(lit.Body.Pos()).Offset:fset.Position(lit.Body.End()).Offset]
+		out := fmt.Sprintf(libfuzzerTemplate,
+			"libfuzzer_"+fn, file.Name.Name, strings.Join(imports, ""),
+			fn, tName, dataName, body)
+		formatted, err := format.Source([]byte(out))
+		if err != nil {
+			return nil, fmt.Errorf("could not format the harness of %s: %w", fn, err)
+		}
+		return formatted, nil
+	}
+	return nil, fmt.Errorf(`fuzz function %s not found in "%s"`, fn, dir)
+}
+
+// wrapLibfuzzerCmd implements the wrap-libfuzzer subcommand
+func wrapLibfuzzerCmd(args []string) {
+	flags := flag.NewFlagSet("wrap-libfuzzer", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, wrapLibfuzzerHelpText)
+		flags.PrintDefaults()
+	}
+	root := flags.String("root", ".", "root dir of the go project")
+	out := flags.String("o", "", "file to write the harness to, instead of FuzzFuncName_libfuzzer.go in the package dir")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	target := strings.TrimPrefix(path.Clean(flags.Arg(0)), "./")
+	pkg, fn := path.Split(target)
+	pkg = path.Clean(pkg)
+	if !fuzzRgx.MatchString("func " + fn) {
+		die(fmt.Errorf(`invalid target "%s": expected path/to/package/FuzzFuncName`, flags.Arg(0)))
+	}
+	if *out != "" {
+		p, err := filepath.Abs(*out)
+		if err != nil {
+			die(err)
+		}
+		*out = p
+	}
+	err := os.Chdir(*root)
+	if err != nil {
+		die(err)
+	}
+	dir := filepath.FromSlash(pkg)
+	harness, err := libfuzzerHarness(dir, fn)
+	if err != nil {
+		die(err)
+	}
+	if *out == "" {
+		*out = filepath.Join(dir, fn+"_libfuzzer.go")
+	}
+	err = os.WriteFile(*out, harness, 0o644)
+	if err != nil {
+		die(fmt.Errorf(`could not write harness "%s": %w`, *out, err))
+	}
+	fmt.Printf("wrote %s\n", *out)
+	fmt.Printf("build it into a c-archive from a main package that imports ./%s, with\n", pkg)
+	fmt.Printf("go build -tags=libfuzzer_%s -gcflags=all=-d=libfuzzer -buildmode=c-archive\n", fn)
+}
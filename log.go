@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+// logger is where gofuzz logs what it does, such as discovering, starting and finishing targets,
+// in the format given by -log-format. decisions are logged at the debug level, which -v enables.
+var logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+// newLogger returns a logger that writes to stderr in the given format, text or json
+func newLogger(format string, verbose bool) (*slog.Logger, error) {
+	opts := &slog.HandlerOptions{Level: slog.LevelInfo}
+	if verbose {
+		opts.Level = slog.LevelDebug
+	}
+	switch format {
+	case "text":
+		return slog.New(slog.NewTextHandler(os.Stderr, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(os.Stderr, opts)), nil
+	}
+	return nil, fmt.Errorf(`invalid -log-format value "%s"`, format)
+}
@@ -1,19 +1,19 @@
 package main
 
 import (
-	"bufio"
 	"context"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"io/fs"
 	"os"
-	"os/exec"
 	"os/signal"
-	"path"
 	"path/filepath"
 	"regexp"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -22,58 +22,316 @@ import (
 )
 
 const helpText = `Usage: gofuzz [OPTIONS...] [-- GOTESTARGS...]
+       gofuzz list [OPTIONS...]
+       gofuzz rerun-failures [OPTIONS...] [-- GOTESTARGS...]
+       gofuzz replay-run [OPTIONS...] RUN
+       gofuzz plan -shards M -o FILE [OPTIONS...] [-- GOTESTARGS...]
+       gofuzz run -plan FILE -shard K [OPTIONS...] [-- GOTESTARGS...]
+       gofuzz stats merge [OPTIONS...] SRCDIR...
+       gofuzz stats import [OPTIONS...] LOGFILE...
+       gofuzz diff [OPTIONS...] RUN_A RUN_B
+       gofuzz gc [OPTIONS...]
+       gofuzz quarantine add|remove|list [OPTIONS...] [TARGET...]
+       gofuzz check [OPTIONS...]
+       gofuzz repro [OPTIONS...] INPUT
+       gofuzz corpus merge [OPTIONS...] SRC...
+       gofuzz corpus dedup [OPTIONS...]
+       gofuzz corpus stats [OPTIONS...]
+       gofuzz migrate [OPTIONS...]
+       gofuzz wrap-libfuzzer [OPTIONS...] TARGET
+       gofuzz gen-diff [OPTIONS...] -a DIR.Func -b DIR.Func
+       gofuzz gen-roundtrip [OPTIONS...] DIR
 
 gofuzz runs Golang fuzz tests in parallel.
 GOTESTARGS are extra args passed to the go test command.
+a "//gofuzz:args ARGS..." comment line right above a fuzz function
+passes ARGS to the go test command of that function only, and similarly,
+"//gofuzz:env NAME=VALUE..." sets environment variables for it, such as
+GOGC and GOMEMLIMIT for targets that benefit from tuning the garbage collector.
+
+each target is run with -run=^FuzzFuncName$ -fuzz=^FuzzFuncName$,
+which first runs its seed corpus as a regular test and then fuzzes it.
+with -run-seeds=false, -run=^$ is used instead, which skips that step;
+the seeds are still used as the starting corpus of the fuzzer.
+list is a shorthand for -list, and rerun-failures for -rerun-failures.
+every run with -stats-dir records its schedule, which replay-run repeats.
+
+the exit status is 0 if every target passed, 1 if a target failed, 2 if a
+target failed to build or set up or gofuzz could not run, such as with an
+invalid option, 3 if the targets could not be discovered, and 130 if the
+run was cancelled by a signal.
+the highest of those that apply is used.
 
 Options:
 `
 
+// exit statuses of a run, of which the highest that applies is used
+const (
+	exitFailure   = 1
+	exitBroken    = 2
+	exitDiscovery = 3
+	exitSignal    = 130
+)
+
+// listFlag is a flag that can be given multiple times
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
 // fuzz contains the name of a fuzz function and the package path it resides in
 type fuzz struct {
 	fn       string
 	pkg      string
 	fullpath string
+	// file is the slash-separated path of the test file that defines the target
+	file string
+	// line is the line of file that the fuzz function is on, or 0 if unknown
+	line int
+	// owners are the owners of file, according to the CODEOWNERS file
+	owners []string
+	// quarantined is set if the target is quarantined, so its failures don't fail the run
+	quarantined bool
+	// args are extra go test args for this target, given by directives
+	args []string
+	// env are extra NAME=VALUE environment variables for this target, given by directives
+	env []string
+	// seeds are the f.Add calls of the fuzz function
+	seeds []inlineSeed
+	// reach is the number of statements reachable from the fuzz function, if the targets are weighed by it
+	reach int
 }
 
 // result contains a fuzzing result
 type result struct {
 	fuzz
-	err    error
-	output string
+	err     error
+	output  string
+	broken  bool
+	skipped bool
+	// cancelled is set if the run was cancelled while f was running
+	cancelled bool
+	env       []string
+	// input is the path of the failing input, if any
+	input    string
+	start    time.Time
+	duration time.Duration
+	// cpu is the cpu time that the command used, including that of its descendants
+	cpu time.Duration
+	// outcome is what the json events of go test told about the run, if it wrote any
+	outcome *testOutcome
+	// compile is the time it took to build the test binary, if known
+	compile time.Duration
+	// sanitized is set once secrets are removed from output,
+	// and failure is then the excerpt of the failure, with secrets removed too; see sanitize
+	sanitized bool
+	failure   *failureExcerpt
+	// withheld is set if sanitize withheld possible secrets from the output or the excerpt
+	withheld bool
+	// skipReason is why the target was skipped without being run, if gofuzz skipped it
+	skipReason string
 }
 
 func main() {
 
+	// handle subcommands
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "list":
+			// list is a shorthand for -list
+			os.Args = append([]string{os.Args[0], "-list"}, os.Args[2:]...)
+		case "replay-run":
+			os.Args = append([]string{os.Args[0]}, replayRunArgs(os.Args[2:])...)
+		case "plan":
+			os.Args = append([]string{os.Args[0]}, planArgs(os.Args[2:])...)
+		case "run":
+			// run is the same as no subcommand, which reads better with -plan and -shard
+			os.Args = append([]string{os.Args[0]}, os.Args[2:]...)
+		case "rerun-failures":
+			// rerun-failures is a shorthand for -rerun-failures
+			os.Args = append([]string{os.Args[0], "-rerun-failures"}, os.Args[2:]...)
+		case "stats":
+			statsCmd(os.Args[2:])
+			return
+		case "diff":
+			diffCmd(os.Args[2:])
+			return
+		case "check":
+			checkCmd(os.Args[2:])
+			return
+		case "repro":
+			reproCmd(os.Args[2:])
+			return
+		case "corpus":
+			corpusCmd(os.Args[2:])
+			return
+		case "quarantine":
+			quarantineCmd(os.Args[2:])
+			return
+		case "gc":
+			gcCmd(os.Args[2:])
+			return
+		case "migrate":
+			migrateCmd(os.Args[2:])
+			return
+		case "wrap-libfuzzer":
+			wrapLibfuzzerCmd(os.Args[2:])
+			return
+		case "gen-diff":
+			genDiffCmd(os.Args[2:])
+			return
+		case "gen-roundtrip":
+			genRoundTripCmd(os.Args[2:])
+			return
+		}
+	}
+
 	// handle cli flags
 	flag.Usage = func() {
 		fmt.Fprint(os.Stderr, helpText)
 		flag.PrintDefaults()
 	}
-	maxParallel := flag.Int("parallel", 10, "max number of parallel tests")
+	maxParallel := flag.Int("parallel", 0, "max number of parallel tests; 0 is the number of cpus that a cgroup cpu quota allows, as in a container, or the number of cpus of the machine where there's no quota, up to 10 either way")
 	matchPtrn := flag.String("match", ".", "only operate on functions where this regexp matches against path/to/package/FuzzFuncName")
 	root := flag.String("root", ".", "root dir of the go project")
-	goTest := flag.String("gotest", "go test", "command used for running tests, as whitespace-separated args")
+	goTest := flag.String("gotest", "go test", "command used for running tests, as whitespace-separated args with shell-like quoting")
+	goTestTemplate := flag.String("gotest-template", "", "template of the command used for running tests, such as 'gotestsum --raw-command -- go test {{.Args}}'. words are split at whitespace and executed as go templates; {{.Args}} expands to the go test args, and {{.Pkg}}, {{.Func}} and {{.Target}} are also available. overrides -gotest")
+	testJSON := flag.Bool("test-json", true, "run go test with -json and parse its event stream, to tell build errors, failures and skipped targets apart precisely; set to false for -gotest commands that don't support -json")
+	short := flag.Bool("short", false, "pass -short to go test, telling targets to skip long-running setup")
+	replay := flag.Bool("replay", false, "only run the seed corpus of each target, as a regular test with -run=^FuzzFuncName$ and without -fuzz, rather than fuzzing it; a fast and deterministic regression check, such as for pull requests")
+	runSeeds := flag.Bool("run-seeds", true, "run the seed corpus of each target as a regular test before fuzzing it (-run=^FuzzFuncName$ rather than -run=^$)")
+	freshCorpus := flag.Bool("fresh-corpus", false, "use an empty temporary fuzz cache for this run instead of the shared one, to measure fuzzing from scratch; seeds in testdata are still used")
+	maxSeedCorpus := flag.String("max-seed-corpus", "", "keep the seed corpus in testdata/fuzz of each target below this size, such as 1MiB, by moving the largest entries to -corpus-overflow")
+	corpusOverflow := flag.String("corpus-overflow", "", "dir that entries beyond -max-seed-corpus are moved to, under path/to/package/FuzzFuncName; its entries are copied into the fuzz cache before every run, so they are still used")
+	var corpusDirs listFlag
+	flag.Var(&corpusDirs, "corpus", "dir of additional corpus entries, such as a shared or downloaded corpus, under path/to/package/FuzzFuncName; can be repeated. the entries are copied into the fuzz cache before each target runs, leaving testdata alone. entries not in the go test format are taken to be raw []byte inputs")
+	sample := flag.String("sample", "", "only run a random subset of the targets, given as a number (10) or a percentage (10%)")
+	sampleSeed := flag.Int64("sample-seed", 0, "seed of the random selection of -sample, to repeat a previous selection; random if 0")
+	weight := flag.String("weight", "reach", "how targets are weighed: reach, which runs the targets that can reach the most code of the tree, according to a static call graph of it, first, and makes -sample favor them; coverage, which runs the targets that cover the packages that are covered the least first, according to the profiles of previous runs under -coverprofile-dir; or none")
+	rotate := flag.Int("rotate", 0, "split the targets into this many cohorts and only run the one fuzzed least recently according to -stats-dir, so that successive runs fuzz every target at least once every this many runs")
+	rerunFailures := flag.Bool("rerun-failures", false, "only run the targets that failed in the previous run, as recorded in the json report given by -from, or else in -stats-dir")
+	from := flag.String("from", "", "json report of the previous run, as written by -reporter json=FILE, for -rerun-failures")
+	rerunFuzztime := flag.String("rerun-fuzztime", "10m", "-fuzztime of targets run by -rerun-failures, which is usually larger than that of regular runs")
 	list := flag.Bool("list", false, "list fuzz function paths and exit")
+	listFormat := flag.String("list-format", "text", "format of -list: text, which lists the paths, or json, which lists each target as a json line with its file, directives and f.Add seed calls, including their literal values where they are simple")
+	followSymlinks := flag.Bool("follow-symlinks", false, "descend into symlinked dirs when looking for fuzz functions")
+	workspace := flag.Bool("workspace", false, "descend into nested modules; use with a go.work file that includes them")
+	skipErrors := flag.Bool("skip-errors", false, "skip unreadable files and dirs with a warning instead of aborting")
+	count := flag.Int("count", 1, "run the seed corpus of each target this many times in the pre-check, as in go test -count, and report the target as broken if any iteration fails, to flush out flaky setup; implies -precheck if above 1")
+	shuffle := flag.String("shuffle", "", "-shuffle of go test for the -precheck runs: off, on or a seed; implies -precheck. note that go test only shuffles top-level tests, not seed corpus entries")
+	coverDir := flag.String("coverprofile-dir", "", "before fuzzing each target, run its seed corpus with -coverprofile and store its coverage profile under this dir, as DIR/path/to/package/FuzzFuncName.cover, which go tool cover can show. with -precheck, the pre-check collects it")
+	coverPkg := flag.String("coverpkg", "", "the -coverpkg of the -coverprofile-dir runs, such as ./..., to cover the packages that the targets reach rather than only their own")
+	precheck := flag.Bool("precheck", false, "before fuzzing a target, run its seed corpus, and report it as broken if it fails to build or pass its seeds")
+	maxSkips := flag.Int("max-skips", -1, "fail if more than this many targets skip instead of fuzzing; negative means no limit")
+	artifactsDir := flag.String("artifacts", "", "save the output and environment of each target under this dir")
+	artifactName := flag.String("artifact-name", defaultArtifactName, "go template of the name of the artifact dir of each target under -artifacts, such as '{{.Pkg}}_{{.Func}}_{{.Date}}_{{.Signature}}'. {{.Pkg}}, {{.Func}}, {{.Target}}, {{.Status}}, {{.Run}}, {{.Date}} and {{.Time}} of the start of the run, and {{.Signature}}, a hash that identifies the failure, are available; slashes make nested dirs")
+	trace := flag.Bool("trace", false, "when a target hangs or stops making progress, run the input that causes it, or else its seed corpus, again with the go execution tracer and save the trace as trace.out among its artifacts. requires -artifacts")
+	traceTimeout := flag.Duration("trace-timeout", time.Minute, "how long a hanging input runs under -trace before it's stopped")
+	var redactEnv listFlag
+	flag.Var(&redactEnv, "redact-env", "redact the values of environment variables whose name matches this regexp from reports, artifacts and the output of -stream and -tui; can be repeated. variables that look like secrets are always redacted")
+	scanSecrets := flag.String("scan-secrets", secretsOff, "what to do with possible secrets in the output and failure excerpts of targets, including that of -stream and -tui, and in artifacts: off; redact, which replaces them; or block, which withholds them and marks the reports of the target as such, and doesn't save the artifacts that contain them")
+	var reporterSpecs listFlag
+	flag.Var(&reporterSpecs, "reporter", "report results with this reporter; can be repeated. one of console, json[=FILE], junit=FILE, tap[=FILE], sarif=FILE, markdown=FILE, github, or exec=CMD which writes json events to the stdin of CMD. defaults to console, plus github when running in github actions")
+	format := flag.String("format", "text", "format of the results on stdout: text, json or tap; json is the same as -json, and tap is test anything protocol output as in -reporter tap. the seed corpus is only printed at the end with text")
+	cpuBudget := flag.Duration("cpu-budget", 0, "stop fuzzing each target once it has used this much cpu time, such as 10m, rather than after a wall-clock -fuzztime, so that targets that fuzz in parallel get no more than those that don't; linux only")
+	timestamps := flag.Bool("timestamps", false, "begin the lines printed by -stream with the time they arrived at, in RFC 3339 format")
+	fairness := flag.Bool("fairness", false, "print how much of the machine time of the run each target got, against the share its -fuzztime meant it to get, and flag the targets that the scheduler starved")
+	top := flag.Int("top", 0, "print the N slowest targets and the N slowest-compiling packages at the end of the run, to help tune the fuzzing budget; the compile times are only known with -test-json")
+	reportFormat := flag.String("report-format", "text", "format of the summary table of -summary-table: text, or csv or markdown for pasting into spreadsheets, wikis and pull requests, which are followed by a table of the findings")
+	failOn := flag.String("fail-on", defaultFailOn, "comma-separated failure categories that fail the run: crash (a panic), race (a data race), hang, error (a failure that is neither, such as of t.Error) and broken (a target that fails to build, set up or pass its pre-check), and quarantined to fail the run on the failures of quarantined targets too. other failures are reported, but don't fail the run")
+	minExecs := flag.Int64("min-execs", 0, "report the targets that were fuzzed, but executed fewer inputs than this, such as those whose f.Fuzz body is dominated by per-input setup, as -min-execs-action says")
+	minExecsAction := flag.String("min-execs-action", "warn", "what to do with the targets below -min-execs: warn, or fail to make them fail")
+	plateau := flag.Duration("plateau", 0, "stop fuzzing a target once it has found no new interesting inputs for this long, so that the time goes to the targets still finding coverage; linux only")
+	extend := flag.Float64("extend", 1, "multiply the -fuzztime of the targets by this, so that the targets still finding coverage fuzz for longer, while -plateau cuts short those that aren't; requires -plateau")
+	totalFuzztime := flag.Duration("total-fuzztime", 0, "total fuzzing time of the run, which is shared by the targets as a -fuzztime for each, according to their number, -parallel, and their weight; -fuzztime directives override it")
+	deadlineFlag := flag.String("deadline", "", "time by which the run must be over, such as the hard timeout of a ci job, as an RFC3339 time or a duration from now. targets fuzz for no longer than the time left before it, the running ones are stopped the -wind-down before it so that the results are reported in time, and the targets that never started are listed as not run. without a -fuzztime or -total-fuzztime, the time left is shared by the targets as with -total-fuzztime")
+	windDown := flag.Duration("wind-down", 30*time.Second, "time before -deadline at which the running targets are stopped, which leaves time for the targets to stop and for the results to be reported")
+	budget := flag.Duration("budget", 0, "wall-clock limit of the whole run, after which the running targets are stopped with SIGTERM, the partial results are reported, and the targets that never started are listed as not run")
+	failfast := flag.Bool("failfast", false, "cancel the targets that are running or yet to run as soon as a target fails or breaks, for quick feedback instead of waiting out every target")
+	maxFailures := flag.Int("max-failures", 0, "cancel the run once this many targets have failed or broken, so that a badly broken branch doesn't keep finding failures for long; unlimited if 0")
+	summaryTable := flag.Bool("summary-table", true, "print a table of the targets at the end of the run, with the status, time, new interesting inputs and crashers found of each, followed by the totals")
+	quiet := flag.Bool("q", false, "only print the output of targets that failed or broke, and a summary, rather than that of every target; the seed corpus isn't printed either")
+	verbose := flag.Bool("v", false, "also log the decisions of gofuzz, such as the targets found, the go test command of each target and why targets are held back")
+	logFormat := flag.String("log-format", "text", "format of what gofuzz logs to stderr: text, as key=value pairs, or json, as a json object per line")
+	veryVerbose := flag.Bool("vv", false, "like -v, and also pass -x to go test, so that the output of targets includes the commands that build them")
+	colorMode := flag.String("color", "auto", "color the console output: auto, which colors it if stdout is a terminal and NO_COLOR isn't set, always or never")
+	progress := flag.Bool("progress", false, "print how many targets have finished, and about how long the rest will take, to stderr after each target finishes")
+	tui := flag.Bool("tui", false, "show a live dashboard of the running targets in the terminal, from which their output can be viewed and they can be cancelled")
+	streamOut := flag.Bool("stream", false, "print the output lines of targets as they arrive, prefixed with path/to/package/FuzzFuncName, rather than all at once when each target finishes")
+	jsonOut := flag.Bool("json", false, "print the results as newline-delimited json events instead of plain text, as in -reporter json, and don't print the seed corpus at the end")
+	junitFile := flag.String("junit", "", "also write a junit xml report to this file, as in -reporter junit=FILE, keeping the other reporters as they are")
+	sarifFile := flag.String("sarif", "", "also write a sarif report of the failed targets to this file, as in -reporter sarif=FILE, for uploading to github code scanning")
+	summaryMD := flag.String("summary-md", "", "also write a markdown summary with a table of the targets and the failing inputs found to this file, such as $GITHUB_STEP_SUMMARY, as in -reporter markdown=FILE")
+	events := flag.String("events", "", "also write the json event stream to this file, named pipe, or fd:N for an open file descriptor such as fd:3, keeping the other reporters as they are")
+	splitBy := flag.String("report-split-by", "", "write a separate report per owner or per top-level dir of the targets: owner or package-prefix. applies to the json=FILE and junit=FILE reporters, whose files are named after each group, as in report.team-x.xml")
+	var pluginCmds listFlag
+	flag.Var(&pluginCmds, "plugin", "run CMD as a plugin; can be repeated. CMD receives json events on stdin, and must answer each event of type schedule with a json line on stdout such as {}, {\"skip\":true} or {\"fuzztime\":\"1m\"}, which decides whether and for how long the target is fuzzed")
+	ownersFile := flag.String("owners", "", "CODEOWNERS file that attributes targets to owners in reports; by default CODEOWNERS, .github/CODEOWNERS, docs/CODEOWNERS or .gitlab/CODEOWNERS under -root, if any")
+	var ownerFilter listFlag
+	flag.Var(&ownerFilter, "owner", "only run the targets owned by this owner, such as @org/team-x or team-x; can be repeated")
+	maxTotalCPU := flag.Float64("max-total-cpu", 0, "hold back further targets while gofuzz and the targets it runs use this many cpus or more, such as 4 or 2.5, so as to leave the rest to other workloads on a shared host; linux only")
+	maxTotalMem := flag.String("max-total-mem", "", "hold back further targets while gofuzz and the targets it runs use this much memory or more, such as 8GiB; linux only. with either, the usage is sampled every second, and a target is only started once the targets before it have been sampled")
+	powerAware := flag.Bool("power-aware", false, "pause before starting further targets while the machine runs on battery or is thermally throttled, until that's no longer the case; linux and macos only")
+	quarantineFile := flag.String("quarantine", defaultQuarantineFile, "quarantine file under -root, as maintained by gofuzz quarantine; quarantined targets are left out")
+	includeQuarantined := flag.Bool("include-quarantined", false, "fuzz quarantined targets too, without failing the run if they fail, as for non-blocking nightly runs")
+	noCache := flag.Bool("no-cache", false, "don't use the discovery cache; scan every test file")
+	discoverBy := flag.String("discover", "scan", "how fuzz functions are found: scan, which scans test files, or list, which runs go test -list with GOTESTARGS in every package with test files, and so only finds the fuzz functions that are actually built, such as those of build tags and generated code")
+	statsDir := flag.String("stats-dir", "", "record results into the stats DB in this dir; every run writes its own shard")
+	note := flag.String("note", "", "free-form note about the run, such as what is being tested, recorded in reports and -stats-dir")
+	var labelFlags listFlag
+	flag.Var(&labelFlags, "label", "KEY=VALUE label of the run, recorded in reports and -stats-dir; can be repeated")
+	writePlanFile := flag.String("write-plan", "", "write a plan that assigns the selected targets to -plan-shards shards to this file, rather than running them; this is what plan does")
+	planShards := flag.Int("plan-shards", 0, "number of shards of -write-plan")
+	planFile := flag.String("plan", "", "run the targets of the -shard of this plan, which plan wrote, in its order and with its -fuzztime, instead of selecting them")
+	planShard := flag.Int("shard", 0, "shard of -plan to run, from 1 to the number of shards of the plan")
+	replaySchedule := flag.String("replay-schedule", "", "run the targets of this schedule file of a previous run, in its order and with its per-target args, instead of selecting them; this is what replay-run does")
 	flag.Parse()
 
+	// log in the requested format from the start
+	if *veryVerbose {
+		*verbose = true
+	}
+	if *quiet && *verbose {
+		die("-q can't be used with -v or -vv.")
+	}
+	var err error
+	logger, err = newLogger(*logFormat, *verbose)
+	if err != nil {
+		die(err)
+	}
+
 	// check for go.mod if -root is not set
-	rootSet := false
+	rootSet, weightSet := false, false
 	flag.Visit(func(f *flag.Flag) {
-		if f.Name == "root" {
+		switch f.Name {
+		case "root":
 			rootSet = true
+		case "weight":
+			weightSet = true
 		}
 	})
 	if !rootSet {
 		_, err := os.Stat("go.mod")
+		if *workspace && errors.Is(err, os.ErrNotExist) {
+			_, err = os.Stat("go.work")
+		}
 		if errors.Is(err, os.ErrNotExist) {
-			die("no go.mod found in current directory.\n" +
-				"set -root explicitly to override the go.mod check.")
+			die("no go.mod found in current directory; set -root explicitly to override the go.mod check.")
 		}
 	}
 
-	// split goTest by whitespace
-	goTestFields := strings.Fields(*goTest)
+	// walkOpts controls how the project tree is walked
+	walkOpts := walkOptions{
+		followSymlinks: *followSymlinks,
+		workspace:      *workspace,
+		skipErrors:     *skipErrors,
+	}
 
 	// compile matchPtrn
 	matchRgx, err := regexp.Compile(*matchPtrn)
@@ -81,6 +339,370 @@ func main() {
 		die(fmt.Errorf("the -match regexp is invalid: %w", err))
 	}
 
+	// parse the go test command
+	goTestFields, err := splitCommand(*goTest)
+	if err == nil && len(goTestFields) == 0 {
+		err = errors.New("empty command")
+	}
+	if err != nil {
+		die(fmt.Errorf("the -gotest command is invalid: %w", err))
+	}
+	goTestCmd := literalCommand(goTestFields)
+	if *goTestTemplate != "" {
+		goTestCmd, err = parseCommandTemplate(*goTestTemplate)
+		if err != nil {
+			die(fmt.Errorf("the -gotest-template is invalid: %w", err))
+		}
+		_, err = goTestCmd.expand(commandData{Args: []string{"./pkg"}, Pkg: "./pkg", Func: "FuzzFunc", Target: "pkg/FuzzFunc"})
+		if err != nil {
+			die(fmt.Errorf("the -gotest-template is invalid: %w", err))
+		}
+	}
+
+	// parse the sample spec
+	var sampleBy sampleSpec
+	if *sample != "" {
+		sampleBy, err = parseSample(*sample)
+		if err != nil {
+			die(fmt.Errorf("the -sample value is invalid: %w", err))
+		}
+		if *sampleSeed == 0 {
+			*sampleSeed = time.Now().UnixNano()
+		}
+	}
+
+	// a replayed run takes its targets and their args from the schedule
+	// rather than selecting them again
+	var sched *runSchedule
+	if *replaySchedule != "" {
+		sched, err = readSchedule(*replaySchedule)
+		if err != nil {
+			die(err)
+		}
+		*rerunFailures, *sample, *rotate, pluginCmds = false, "", 0, nil
+	}
+
+	// a shard of a plan is run like a replayed run, as its targets and their -fuzztime were selected by the plan
+	if (*planFile == "") != (*planShard == 0) {
+		die("-plan and -shard require each other.")
+	}
+	if *planFile != "" {
+		if sched != nil {
+			die("-plan and -replay-schedule are mutually exclusive.")
+		}
+		plan, err := readPlan(*planFile)
+		if err != nil {
+			die(err)
+		}
+		sched, err = plan.schedule(*planShard)
+		if err != nil {
+			die(err)
+		}
+		*rerunFailures, *sample, *rotate, *totalFuzztime, pluginCmds = false, "", 0, 0, nil
+		logger.Info("running shard of plan", "shard", *planShard, "shards", plan.Shards, "targets", len(sched.Targets))
+	}
+	if (*writePlanFile == "") != (*planShards == 0) {
+		die("-write-plan and -plan-shards require each other.")
+	}
+	if *planShards < 0 {
+		die("-plan-shards must not be negative.")
+	}
+
+	// rotation relies on the stats DB to know what was fuzzed before
+	if *rotate < 0 {
+		die("-rotate must not be negative.")
+	}
+	labels, err := parseLabels(labelFlags)
+	if err != nil {
+		die(err)
+	}
+
+	if *rotate > 0 && *statsDir == "" {
+		die("-rotate requires -stats-dir.")
+	}
+	if *rotate > 0 && *sample != "" {
+		die("-rotate and -sample are mutually exclusive.")
+	}
+
+	// find the targets that failed in the previous run
+	var previousFailures map[string]bool
+	if *rerunFailures {
+		switch {
+		case *from != "":
+			previousFailures, err = failuresFromReport(*from)
+		case *statsDir != "":
+			previousFailures, err = failuresFromStats(statsDB{dir: *statsDir})
+		default:
+			err = errors.New("-rerun-failures requires -from or -stats-dir")
+		}
+		if err != nil {
+			die(err)
+		}
+	}
+
+	// compile the redaction patterns
+	redactRgxs := []*regexp.Regexp{regexp.MustCompile(defaultRedactEnv)}
+	for _, ptrn := range redactEnv {
+		rgx, err := regexp.Compile(ptrn)
+		if err != nil {
+			die(fmt.Errorf("the -redact-env regexp is invalid: %w", err))
+		}
+		redactRgxs = append(redactRgxs, rgx)
+	}
+
+	// validate the secret scanning policy
+	switch *scanSecrets {
+	case secretsOff, secretsRedact, secretsBlock:
+	default:
+		die(fmt.Sprintf(`invalid -scan-secrets value "%s".`, *scanSecrets))
+	}
+
+	// parse the seed corpus size limit
+	var seedLimit int64
+	if *maxSeedCorpus != "" {
+		seedLimit, err = parseSize(*maxSeedCorpus)
+		if err != nil {
+			die(fmt.Errorf("the -max-seed-corpus value is invalid: %w", err))
+		}
+	}
+	if (*maxSeedCorpus == "") != (*corpusOverflow == "") {
+		die("-max-seed-corpus and -corpus-overflow must be used together.")
+	}
+
+	artifactNameTmpl, err := parseArtifactName(*artifactName)
+	if err != nil {
+		die(fmt.Errorf("the -artifact-name template is invalid: %w", err))
+	}
+	if *coverPkg != "" && *coverDir == "" {
+		die("-coverpkg requires -coverprofile-dir.")
+	}
+	if *trace && *artifactsDir == "" {
+		die("-trace requires -artifacts.")
+	}
+
+	// make paths absolute, as they are relative to the original working dir
+	for _, p := range []*string{statsDir, artifactsDir, ownersFile, corpusOverflow, coverDir, writePlanFile} {
+		if *p != "" {
+			*p, err = filepath.Abs(*p)
+			if err != nil {
+				die(err)
+			}
+		}
+	}
+	for i := range corpusDirs {
+		corpusDirs[i], err = filepath.Abs(corpusDirs[i])
+		if err != nil {
+			die(err)
+		}
+	}
+
+	// create the reporters before changing dirs,
+	// as the paths of their files are relative to the original working dir
+	switch *format {
+	case "text":
+	case "json":
+		*jsonOut = true
+	case "tap":
+	default:
+		die(fmt.Sprintf(`invalid -format value "%s".`, *format))
+	}
+	if *jsonOut || *format == "tap" {
+		// json and tap replace the plain text of the console reporter on stdout
+		reporterSpecs = slices.DeleteFunc(reporterSpecs, func(spec string) bool {
+			return spec == "console"
+		})
+		if *jsonOut {
+			reporterSpecs = append(reporterSpecs, "json")
+		} else {
+			reporterSpecs = append(reporterSpecs, "tap")
+		}
+	}
+	if len(reporterSpecs) == 0 {
+		reporterSpecs = listFlag{"console"}
+	}
+	// annotate failures in github actions, unless stdout is meant to be parsed
+	if os.Getenv("GITHUB_ACTIONS") == "true" && !*jsonOut && *format != "tap" && !slices.Contains(reporterSpecs, "github") {
+		reporterSpecs = append(reporterSpecs, "github")
+	}
+	if *junitFile != "" {
+		reporterSpecs = append(reporterSpecs, "junit="+*junitFile)
+	}
+	if *summaryMD != "" {
+		reporterSpecs = append(reporterSpecs, "markdown="+*summaryMD)
+	}
+	if *sarifFile != "" {
+		reporterSpecs = append(reporterSpecs, "sarif="+*sarifFile)
+	}
+	if *events != "" {
+		reporterSpecs = append(reporterSpecs, "json="+*events)
+	}
+	limits := resourceLimits{cpu: *maxTotalCPU}
+	if *maxTotalMem != "" {
+		limits.mem, err = parseSize(*maxTotalMem)
+		if err != nil {
+			die(fmt.Errorf("the -max-total-mem value is invalid: %w", err))
+		}
+	}
+	if *cpuBudget > 0 {
+		if _, err := treeCPUTime(os.Getpid()); err != nil {
+			die(fmt.Errorf("-cpu-budget can't be used: %w", err))
+		}
+	}
+	if *plateau > 0 {
+		if _, err := treeCPUTime(os.Getpid()); err != nil {
+			die(fmt.Errorf("-plateau can't be used: %w", err))
+		}
+	}
+	if *extend < 1 {
+		die("-extend must be at least 1.")
+	}
+	if *extend > 1 && *plateau <= 0 {
+		die("-extend requires -plateau.")
+	}
+	color, err := useColor(*colorMode, os.Stdout)
+	if err != nil {
+		die(err)
+	}
+	if *timestamps && !*streamOut {
+		die("-timestamps requires -stream.")
+	}
+	if *tui {
+		if *jsonOut || *format == "tap" || *streamOut || *progress {
+			die("-tui can't be used with -json, -format tap, -stream or -progress.")
+		}
+		if info, err := os.Stdout.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+			die("-tui requires stdout to be a terminal.")
+		}
+	}
+	if *count < 1 {
+		die("-count must be at least 1.")
+	}
+	if *count > 1 || *shuffle != "" {
+		*precheck = true
+	}
+
+	switch *listFormat {
+	case "text", "json":
+	default:
+		die(fmt.Sprintf(`invalid -list-format value "%s".`, *listFormat))
+	}
+
+	switch *reportFormat {
+	case "text", "csv", "markdown":
+	default:
+		die(fmt.Sprintf(`invalid -report-format value "%s".`, *reportFormat))
+	}
+	failurePolicy, err := parseFailurePolicy(*failOn)
+	if err != nil {
+		die(fmt.Errorf("the -fail-on value is invalid: %w", err))
+	}
+	switch *minExecsAction {
+	case "warn", "fail":
+	default:
+		die(fmt.Sprintf(`invalid -min-execs-action value "%s".`, *minExecsAction))
+	}
+	if *totalFuzztime < 0 {
+		die("-total-fuzztime must not be negative.")
+	}
+	if *totalFuzztime > 0 && fuzztimeArg(flag.Args()) != "" {
+		die("-total-fuzztime and a -fuzztime in GOTESTARGS are mutually exclusive.")
+	}
+	var stopBy time.Time
+	if *deadlineFlag != "" {
+		deadline, err := parseDeadline(*deadlineFlag, time.Now())
+		if err != nil {
+			die(err)
+		}
+		if *windDown < 0 {
+			die("-wind-down must not be negative.")
+		}
+		stopBy = deadline.Add(-*windDown)
+		if !stopBy.After(time.Now()) {
+			die(fmt.Sprintf("-deadline of %s leaves no time to run after the -wind-down of %s.", deadline.Format(time.RFC3339), *windDown))
+		}
+		if *totalFuzztime == 0 && fuzztimeArg(flag.Args()) == "" && sched == nil {
+			*totalFuzztime = time.Until(stopBy).Truncate(time.Second)
+		}
+	}
+	if *budget < 0 {
+		die("-budget must not be negative.")
+	}
+	if *maxParallel < 0 {
+		die("-parallel must not be negative.")
+	}
+	if *maxParallel == 0 {
+		*maxParallel = defaultParallel()
+	}
+	if *maxFailures < 0 {
+		die("-max-failures must not be negative.")
+	}
+	if *reportFormat != "text" && !*summaryTable {
+		die("-report-format requires -summary-table.")
+	}
+
+	switch *weight {
+	case "reach", "none":
+	case "coverage":
+		if *coverDir == "" {
+			die("-weight coverage requires -coverprofile-dir.")
+		}
+	default:
+		die(fmt.Sprintf(`invalid -weight value "%s".`, *weight))
+	}
+
+	switch *discoverBy {
+	case "scan", "list":
+	default:
+		die(fmt.Sprintf(`invalid -discover value "%s".`, *discoverBy))
+	}
+
+	switch *splitBy {
+	case "", splitByOwner, splitByPackagePrefix:
+	default:
+		die(fmt.Sprintf(`invalid -report-split-by value "%s".`, *splitBy))
+	}
+	reporters := &reporterList{run: newRunID()}
+	for _, spec := range reporterSpecs {
+		var rep reporter
+		kind, _, _ := strings.Cut(spec, "=")
+		if *splitBy != "" && (kind == "json" || kind == "junit") {
+			rep, err = newSplitReporter(spec, *splitBy)
+		} else {
+			rep, err = newReporter(spec)
+		}
+		if err != nil {
+			die(fmt.Errorf("invalid -reporter: %w", err))
+		}
+		if c, ok := rep.(*consoleReporter); ok {
+			c.listFailed = *precheck
+			c.streamed = *streamOut
+			c.quiet = *quiet
+			c.color = color
+			c.table = *summaryTable
+			c.format = *reportFormat
+			c.top = *top
+			c.fair = *fairness
+		}
+		reporters.reporters = append(reporters.reporters, rep)
+	}
+
+	// start the plugins, which also receive every event that reporters do
+	var plugins []*plugin
+	for _, command := range pluginCmds {
+		p, err := newPlugin(command, reporters.run)
+		if err != nil {
+			die(fmt.Errorf("invalid -plugin: %w", err))
+		}
+		plugins = append(plugins, p)
+		reporters.reporters = append(reporters.reporters, p)
+	}
+
+	// the dir that gofuzz was started in, which replay-run starts it in again
+	startDir, err := os.Getwd()
+	if err != nil {
+		die(err)
+	}
+
 	// chdir to root
 	err = os.Chdir(*root)
 	if err != nil {
@@ -90,36 +712,104 @@ func main() {
 	// context allows canceling the running commands
 	ctx, cancel := context.WithCancelCause(context.Background())
 
-	// cancel the context upon receiving signals that typically terminate programs
+	// cancel the context upon receiving signals that typically terminate programs.
+	// SIGPIPE isn't one of them, so that a reporter that goes away
+	// makes writing to it fail rather than cancel the run.
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan,
 		os.Interrupt,
 		syscall.SIGTERM,
 		syscall.SIGHUP,
-		syscall.SIGPIPE,
 		syscall.SIGQUIT,
 	)
+	// success indicates whether the run succeeded, and exitCode is the exit status of gofuzz
+	// if it's more specific than the 1 of a failed run
+	var success atomic.Bool
+	success.Store(true)
+	var exitCode atomic.Int32
+	raise := func(code int32) {
+		for {
+			old := exitCode.Load()
+			if code <= old || exitCode.CompareAndSwap(old, code) {
+				return
+			}
+		}
+	}
+
 	go func() {
 		for sig := range sigChan {
+			raise(exitSignal)
 			cancel(errors.New("received signal " + sig.String()))
 		}
 	}()
 
-	// success indicates what the exit status of gofuzz should be
-	var success atomic.Bool
-	success.Store(true)
-
-	// exit with the appropriate status
+	// run the end-of-run steps and exit with the appropriate status,
+	// even if the run panics
 	defer func() {
-		if success.Load() {
-			os.Exit(0)
-		} else {
-			os.Exit(1)
+		if v := recover(); v != nil {
+			printPanic(v)
+			cancel(fmt.Errorf("gofuzz panicked: %v", v))
+			success.Store(false)
 		}
+		finalizers.run()
+		code := exitCode.Load()
+		if code == 0 && !success.Load() {
+			code = exitFailure
+		}
+		os.Exit(int(code))
 	}()
 
-	// fuzzRgx is a regexp that matches go fuzz functions
-	fuzzRgx := regexp.MustCompile(`^func\s+(Fuzz\w+)`)
+	// close the reporters last
+	finalizers.add(func() {
+		err := reporters.close()
+		if err != nil {
+			logger.Error("could not close the reporters", "err", err)
+			success.Store(false)
+		}
+	})
+
+	// load the owners of the targets
+	owners, err := loadOwners(*ownersFile)
+	if err != nil {
+		die(err)
+	}
+	if len(ownerFilter) > 0 && owners == nil {
+		die("-owner requires a CODEOWNERS file.")
+	}
+
+	// load the quarantined targets, warning about expired quarantines
+	quarantine, err := loadQuarantine(*quarantineFile)
+	if err != nil {
+		die(err)
+	}
+	quarantined := quarantine.active(time.Now())
+
+	// discovered counts the targets to run, for the dashboard and the progress lines
+	var discovered targetCount
+
+	// show the dashboard, which takes over the terminal until the run ends
+	var dash *dashboard
+	if *tui {
+		dash, err = newDashboard(&discovered)
+		if err != nil {
+			die(err)
+		}
+		finalizers.add(dash.stop)
+		for _, rep := range reporters.reporters {
+			if c, ok := rep.(*consoleReporter); ok {
+				c.w = dash.deferredWriter()
+			}
+		}
+		reporters.reporters = append(reporters.reporters, dash)
+	}
+	if *progress {
+		reporters.reporters = append(reporters.reporters, &progressReporter{
+			w:        os.Stderr,
+			targets:  &discovered,
+			parallel: *maxParallel,
+			fuzztime: fuzztimeDuration(fuzztimeArg(flag.Args())),
+		})
+	}
 
 	// fuzzChan contains fuzz functions to run
 	fuzzChan := make(chan fuzz, 1024)
@@ -127,59 +817,166 @@ func main() {
 	// find fuzz functions in go test files and send them to fuzzChan
 	go func() {
 		defer close(fuzzChan)
-		err := filepath.WalkDir(".", func(
-			p string,
-			entry fs.DirEntry,
-			err error,
-		) error {
-			if err != nil {
-				return err
-			}
-			if entry.IsDir() || !strings.HasSuffix(p, "_test.go") {
-				return nil
-			}
-			file, err := os.Open(p)
-			if err != nil {
-				return fmt.Errorf(`could not open file "%s": %w`, p, err)
-			}
-			defer file.Close()
-			sc := bufio.NewScanner(file)
-			for sc.Scan() {
-				matches := fuzzRgx.FindStringSubmatch(sc.Text())
-				if matches == nil || len(matches) < 2 {
-					continue
-				}
-				fn := matches[1]
-				pkg := path.Clean(path.Dir(filepath.ToSlash(p)))
-				fullpath := pkg + "/" + fn
-				if matchRgx.MatchString(fullpath) {
-					fuzzChan <- fuzz{
-						fn:       fn,
-						pkg:      pkg,
-						fullpath: fullpath,
-					}
-				}
-			}
-			err = sc.Err()
-			if err != nil {
-				return fmt.Errorf(`could not scan "%s": %w`, p, err)
-			}
-			return nil
-		})
+		var cache *discoveryCache
+		if !*noCache {
+			cache = loadDiscoveryCache()
+		}
+		var err error
+		if *discoverBy == "list" {
+			err = discoverByList(matchRgx, walkOpts, cache, flag.Args(), fuzzChan)
+		} else {
+			err = discover(matchRgx, walkOpts, cache, fuzzChan)
+		}
 		if err != nil {
-			cancel(fmt.Errorf("could not walk dir: %w", err))
+			logger.Error("could not discover the targets", "err", err)
+			err = fmt.Errorf("could not walk dir: %w", err)
+			raise(exitDiscovery)
+			cancel(err)
 			success.Store(false)
 		}
 	}()
 
-	// if the list option is set, list fuzz function paths and exit
+	// targets contains the fuzz functions to operate on,
+	// each of which is only run once even if it's defined more than once
+	targets := dedupTargets(fuzzChan)
+
+	// attribute the targets to their owners, and only keep those of -owner
+	if owners != nil {
+		targets = assignOwners(targets, owners, ownerFilter)
+	}
+
+	// leave out or mark the quarantined targets
+	if len(quarantined) > 0 {
+		targets = quarantineTargets(targets, quarantined, *includeQuarantined)
+	}
+
+	// run the targets of a replayed run in the order it did
+	if sched != nil {
+		targets = stream(sched.ordered(collect(targets)))
+	}
+
+	// only keep the targets that failed previously
+	if *rerunFailures {
+		all := collect(targets)
+		failed := filterTargets(all, previousFailures)
+		logger.Info("rerunning the targets that failed previously", "targets", len(failed))
+		targets = stream(failed)
+	}
+
+	// listing doesn't run the targets, so it doesn't weigh them,
+	// and neither does planning unless -weight is set, as the order of a plan is its own
+	weigh := sched == nil && !*list && (*writePlanFile == "" || weightSet)
+
+	// run the targets that cover the least exercised code first
+	if *weight == "coverage" && weigh {
+		targets = stream(prioritizeByCoverage(collect(targets), *coverDir))
+	}
+
+	// weigh the targets by the code they can reach, and run the heaviest first.
+	// a replayed run keeps its order.
+	if *weight == "reach" && weigh {
+		all := collect(targets)
+		g, err := buildCodeGraph(walkOpts)
+		if err != nil {
+			logger.Warn("could not weigh targets", "err", err)
+			targets = stream(all)
+		} else {
+			targets = stream(weighTargets(all, g))
+		}
+	}
+
+	// select a random subset of targets.
+	// the seed is printed so that the selection can be repeated.
+	if *sample != "" {
+		all := collect(targets)
+		picked := sampleTargets(all, sampleBy, *sampleSeed)
+		logger.Info("sampled targets", "picked", len(picked), "targets", len(all), "sample-seed", *sampleSeed)
+		targets = stream(picked)
+	}
+
+	// select the cohort of targets that is due to be fuzzed
+	if *rotate > 0 {
+		recs, err := statsDB{dir: *statsDir}.records()
+		if err != nil {
+			die(err)
+		}
+		all := collect(targets)
+		picked, cohort := rotateTargets(all, *rotate, recs)
+		logger.Info("running cohort", "cohort", cohort+1, "cohorts", *rotate, "picked", len(picked), "targets", len(all))
+		targets = stream(picked)
+	}
+
+	// share the total fuzzing time among the targets
+	if *totalFuzztime > 0 {
+		all := collect(targets)
+		targets = stream(distributeFuzztime(all, *totalFuzztime, *maxParallel))
+	}
+
+	// count the targets that are yet to run
+	if dash != nil || *progress {
+		targets = discovered.count(targets)
+	}
+
+	// write the plan of the selected targets, and exit
+	if *writePlanFile != "" {
+		var recs []statsRecord
+		if *statsDir != "" {
+			recs, err = statsDB{dir: *statsDir}.records()
+			if err != nil {
+				die(err)
+			}
+		}
+		plan := makePlan(collect(targets), *planShards, flag.Args(), recs)
+		err = writePlan(*writePlanFile, plan)
+		if err != nil {
+			die(err)
+		}
+		for _, s := range plan.Assignments {
+			logger.Info("planned shard", "shard", s.Shard, "targets", len(s.Targets), "expected", s.Expected)
+		}
+		return
+	}
+
+	// if the list option is set, list fuzz function paths, or their details, and exit
 	if *list {
-		for fuzz := range fuzzChan {
-			fmt.Println(fuzz.fullpath)
+		enc := json.NewEncoder(os.Stdout)
+		for fuzz := range targets {
+			if *listFormat == "json" {
+				enc.Encode(fuzz.listing())
+			} else {
+				fmt.Println(fuzz.fullpath)
+			}
 		}
 		return
 	}
 
+	// open this run's shard of the stats DB.
+	// listing and planning don't run targets, so they don't record a run.
+	var shard *statsShard
+	if *statsDir != "" {
+		shard, err = statsDB{dir: *statsDir}.openShard(reporters.run)
+		if err != nil {
+			die(err)
+		}
+		shard.note, shard.labels = *note, labels
+		finalizers.add(func() { shard.close() })
+	}
+
+	// record the order and args of the targets, so that the run can be replayed
+	var recorder scheduleRecorder
+	if shard != nil {
+		finalizers.add(func() {
+			err := recorder.save(statsDB{dir: *statsDir}, runSchedule{
+				Run:  reporters.run,
+				Dir:  startDir,
+				Args: os.Args[1:],
+			})
+			if err != nil {
+				logger.Warn("could not save the schedule", "err", err)
+			}
+		})
+	}
+
 	// resultChan contains fuzzing results
 	resultChan := make(chan result, 1024)
 
@@ -196,7 +993,116 @@ func main() {
 		}
 	}()
 
-	// get fuzz functions from fuzzChan and run them using `go test`
+	// point the fuzz cache at an empty dir that only lives for this run
+	fuzzCacheDir := ""
+	if *freshCorpus {
+		fuzzCacheDir, err = os.MkdirTemp("", "gofuzz-cache-")
+		if err != nil {
+			die(fmt.Errorf("could not create temporary fuzz cache: %w", err))
+		}
+		finalizers.add(func() { os.RemoveAll(fuzzCacheDir) })
+	}
+
+	// corpus manages the corpus entries that live outside of testdata
+	corpus := corpusStore{
+		cacheDir: fuzzCacheDir,
+		fresh:    *freshCorpus,
+		limit:    seedLimit,
+		overflow: *corpusOverflow,
+		external: corpusDirs,
+	}
+	if (*corpusOverflow != "" || len(corpusDirs) > 0) && !*freshCorpus {
+		corpus.cacheDir, err = goCacheDir()
+		if err != nil {
+			die(err)
+		}
+	}
+
+	// run contains what's needed to run the go test commands
+	run := runner{
+		ctx:        ctx,
+		goTest:     goTestCmd,
+		goTestArgs: flag.Args(),
+		short:      *short,
+		runSeeds:   *runSeeds,
+		fuzzCache:  fuzzCacheDir,
+		count:      *count,
+		shuffle:    *shuffle,
+		cpuBudget:  *cpuBudget,
+		plateau:    *plateau,
+		testJSON:   *testJSON,
+		env:        gomaxprocsEnv(),
+		replay:     *replay,
+		coverDir:   *coverDir,
+		coverPkg:   *coverPkg,
+		redactRgxs: redactRgxs,
+		secrets:    *scanSecrets,
+	}
+	if *veryVerbose {
+		run.goTestArgs = append([]string{"-x"}, run.goTestArgs...)
+	}
+	if *streamOut {
+		run.stream = &lineWriter{w: os.Stdout, timestamps: *timestamps}
+	}
+	if dash != nil {
+		run.stream = dash
+	}
+
+	runStart := time.Now()
+	if *budget > 0 {
+		budgetTimer := time.AfterFunc(*budget, func() {
+			cancel(fmt.Errorf("-budget of %s used up", *budget))
+		})
+		finalizers.add(func() { budgetTimer.Stop() })
+	}
+	if !stopBy.IsZero() {
+		deadlineTimer := time.AfterFunc(time.Until(stopBy), func() {
+			cancel(fmt.Errorf("-deadline is %s away", *windDown))
+		})
+		finalizers.add(func() { deadlineTimer.Stop() })
+	}
+	reporters.report(event{Type: eventRunStart, Time: runStart, Seed: *sampleSeed, Note: *note, Labels: labels})
+
+	// sample the resource usage of the run, to hold back targets while it's at the limits
+	var monitor *resourceMonitor
+	if limits != (resourceLimits{}) {
+		monitor, err = newResourceMonitor(ctx, limits)
+		if err != nil {
+			die(fmt.Errorf("-max-total-cpu and -max-total-mem can't be used: %w", err))
+		}
+	}
+
+	// sum counts the results of the run, failed are the results that failed,
+	// and failures counts the targets that failed or broke, for -max-failures
+	var sum summary
+	var failed []result
+	failures := 0
+
+	// notRun are the targets that never started because the run was cancelled first
+	var notRunMu sync.Mutex
+	var notRun []string
+
+	// finish the reports, which only contain partial results
+	// if the run was cancelled or panicked
+	finalizers.add(func() {
+		end := event{Type: eventRunEnd, Summary: &sum, Clusters: clusterFailures(failed)}
+		notRunMu.Lock()
+		end.NotRun = slices.Clone(notRun)
+		sort.Strings(end.NotRun)
+		notRunMu.Unlock()
+		if ctx.Err() != nil {
+			success.Store(false)
+			end.Status = "cancelled"
+			end.Error = context.Cause(ctx).Error()
+		}
+		sum.Success = success.Load()
+		if elapsed := time.Since(runStart); elapsed > 0 {
+			sum.ExecsPerSec = float64(sum.Execs) / elapsed.Seconds()
+		}
+		reporters.report(end)
+	})
+
+	// get fuzz functions from targets and run them using `go test`
 	go func() {
 		var wg sync.WaitGroup
 		defer func() {
@@ -204,68 +1110,236 @@ func main() {
 			close(resultChan)
 			close(spawnChan)
 		}()
-		for fuzz := range fuzzChan {
+		seq := 0
+		for fuzz := range targets {
+			seq++
+			seq := seq
 			<-spawnChan
-			args := make([]string, len(goTestFields))
-			copy(args, goTestFields)
-			args = append(args,
-				"./"+fuzz.pkg,
-				fmt.Sprintf("-run=^%s$", fuzz.fn),
-				fmt.Sprintf("-fuzz=^%s$", fuzz.fn),
-			)
-			args = append(args, flag.Args()...)
-			cmd := exec.CommandContext(ctx, args[0], args[1:]...)
-			cmd.WaitDelay = 10 * time.Second
-			cmd.Cancel = func() error {
-				return cmd.Process.Signal(syscall.SIGTERM)
+			if *powerAware {
+				waitForPower(ctx)
+			}
+			if monitor != nil {
+				monitor.wait(ctx)
 			}
+			logger.Debug("taking up target", "target", fuzz.fullpath, "seq", seq)
 			wg.Add(1)
 			go func() {
 				defer func() {
+					// a panic fails the target rather than ending the run without reports
+					if v := recover(); v != nil {
+						printPanic(v)
+						resultChan <- result{fuzz: fuzz, err: fmt.Errorf("gofuzz panicked while running the target: %v", v)}
+					}
 					spawnChan <- struct{}{}
 					wg.Done()
 				}()
-				output, err := cmd.CombinedOutput()
-				resultChan <- result{
-					fuzz:   fuzz,
-					output: string(output),
-					err:    err,
+				// targets that haven't started when the run is cancelled are left out
+				if ctx.Err() != nil {
+					logger.Debug("not starting target, as the run was cancelled", "target", fuzz.fullpath)
+					notRunMu.Lock()
+					notRun = append(notRun, fuzz.fullpath)
+					notRunMu.Unlock()
+					return
+				}
+				// the target can be cancelled on its own from the dashboard
+				tctx, tcancel := context.WithCancel(ctx)
+				defer tcancel()
+				run := run
+				run.ctx = tctx
+				if dash != nil {
+					dash.track(fuzz, tcancel)
+				}
+				var extra []string
+				if *rerunFailures {
+					extra = append(extra, "-fuzztime="+*rerunFuzztime)
+				}
+				if len(plugins) > 0 {
+					d, err := schedule(plugins, fuzz)
+					if err != nil {
+						logger.Error("plugin failed", "target", fuzz.fullpath, "err", err)
+						err = fmt.Errorf("plugin failed: %w", err)
+						cancel(err)
+						success.Store(false)
+						return
+					}
+					if d.Skip {
+						logger.Info("skipping target as decided by plugin", "target", fuzz.fullpath, "reason", d.Reason)
+						reason := "skipped by plugin"
+						if d.Reason != "" {
+							reason += ": " + d.Reason
+						}
+						resultChan <- result{fuzz: fuzz, skipped: true, skipReason: reason, start: time.Now()}
+						return
+					}
+					if d.Fuzztime != "" {
+						logger.Debug("fuzztime decided by plugin", "target", fuzz.fullpath, "fuzztime", d.Fuzztime, "reason", d.Reason)
+						extra = append(extra, "-fuzztime="+d.Fuzztime)
+					}
+				}
+				if sched != nil {
+					extra = sched.args(fuzz.fullpath)
+				}
+				recorder.add(seq, fuzz.fullpath, extra)
+				err := corpus.prepare(fuzz)
+				if err != nil {
+					logger.Warn("could not prepare the corpus", "target", fuzz.fullpath, "err", err)
+				}
+				// let the target fuzz for longer, in case it keeps finding coverage
+				if *extend > 1 {
+					if d := fuzztimeDuration(fuzztimeArg(slices.Concat(run.goTestArgs, fuzz.args, extra))); d > 0 {
+						extended := time.Duration(float64(d) * *extend).Round(time.Second)
+						extra = append(extra, "-fuzztime="+extended.String())
+					}
+				}
+				// make the target finish fuzzing before the run has to stop
+				if !stopBy.IsZero() {
+					fuzztime, ok := deadlineFuzztime(slices.Concat(run.goTestArgs, fuzz.args, extra), stopBy, time.Now())
+					if !ok {
+						logger.Debug("not starting target, as there's no time left before -deadline", "target", fuzz.fullpath)
+						notRunMu.Lock()
+						notRun = append(notRun, fuzz.fullpath)
+						notRunMu.Unlock()
+						return
+					}
+					if fuzztime != "" {
+						extra = append(extra, fuzztime)
+					}
+				}
+				start := fuzzEvent(eventTargetStart, fuzz)
+				start.Fuzztime = fuzztimeArg(slices.Concat(run.goTestArgs, fuzz.args, extra))
+				reporters.report(start)
+				if *precheck {
+					res := run.precheck(fuzz)
+					res.cancelled = tctx.Err() != nil
+					if res.broken || res.cancelled {
+						resultChan <- res
+						return
+					}
+				}
+				if run.coverDir != "" && !*precheck {
+					run.cover(fuzz)
+				}
+				res := run.run(fuzz, extra...)
+				res.cancelled = tctx.Err() != nil
+				if t, ok := res.throughput(); ok && *minExecs > 0 && t.execs < *minExecs && res.status() == "pass" {
+					if *minExecsAction == "fail" {
+						res.err = fmt.Errorf("only %d inputs were executed, fewer than the -min-execs of %d; per-input setup in f.Fuzz may be keeping the target from being fuzzed", t.execs, *minExecs)
+					} else {
+						logger.Warn("target executed fewer inputs than -min-execs; per-input setup in f.Fuzz may be keeping it from being fuzzed",
+							"target", fuzz.fullpath, "execs", t.execs, "min-execs", *minExecs)
+					}
+				}
+				if *trace && !res.cancelled && res.hung() {
+					artifacts := artifactStore{dir: *artifactsDir, name: artifactNameTmpl, run: reporters.run, date: runStart}
+					dir, err := artifacts.targetDir(res)
+					if err == nil {
+						err = os.MkdirAll(dir, 0o755)
+					}
+					if err == nil {
+						err = run.trace(res, filepath.Join(dir, "trace.out"), *traceTimeout)
+					}
+					if err != nil {
+						logger.Warn("could not trace the hanging target", "target", fuzz.fullpath, "err", err)
+					}
 				}
+				resultChan <- res
 			}()
 		}
 	}()
 
-	// print fuzzing results
+	// seedDirs are the seed corpus dirs of the targets that ran,
+	// which are printed at the end
+	seedDirs := make(map[string]bool)
+
+	// report fuzzing results
 	for r := range resultChan {
-		fmt.Printf("===== %s/%s =====\n", r.pkg, r.fn)
-		fmt.Println(r.output)
-		if r.err != nil {
+		logger.Debug("target finished", "target", r.fullpath, "status", r.status(), "duration", r.duration)
+		// every report and artifact is made of the result, so secrets are removed from it once, before any of them
+		redactor := newRedactor(redactRgxs, r.env)
+		r = r.sanitize(redactor, *scanSecrets)
+		sum.add(r)
+		seedDirs[seedDir(r.fuzz)] = true
+		// targets cancelled from the dashboard don't fail the run on their own,
+		// and neither do the failures that -fail-on leaves out
+		if failurePolicy.fails(r) {
 			success.Store(false)
-			if !strings.Contains(r.err.Error(), "exit status") {
-				fmt.Println(r.err)
-				fmt.Println()
+			if r.status() == "broken" {
+				raise(exitBroken)
+			} else {
+				raise(exitFailure)
 			}
+			if *failfast {
+				cancel(fmt.Errorf("-failfast: %s has status %s", r.fullpath, r.status()))
+			}
+			failures++
+			if *maxFailures > 0 && failures == *maxFailures {
+				cancel(fmt.Errorf("-max-failures: %d targets failed or broke", failures))
+			}
+		}
+		if r.status() == "fail" {
+			failed = append(failed, r)
+			reporters.report(resultEvent(eventFinding, r))
 		}
+		reporters.report(resultEvent(eventTargetFinish, r))
+		if *artifactsDir != "" {
+			artifacts := artifactStore{
+				dir:      *artifactsDir,
+				name:     artifactNameTmpl,
+				redactor: redactor,
+				secrets:  *scanSecrets,
+				run:      reporters.run,
+				date:     runStart,
+			}
+			err := artifacts.save(r)
+			if err != nil {
+				logger.Error("could not save the artifacts", "target", r.fullpath, "err", err)
+				success.Store(false)
+			}
+		}
+		if shard != nil {
+			err := shard.write(r.record())
+			if err != nil {
+				logger.Error("could not record the result in the stats DB", "target", r.fullpath, "err", err)
+				success.Store(false)
+			}
+		}
+	}
+
+	if *maxSkips >= 0 && sum.Skipped > *maxSkips {
+		logger.Error("more targets skipped than the -max-skips limit", "skipped", sum.Skipped, "max-skips", *maxSkips)
+		success.Store(false)
+	}
+
+	// finish the reports before the seed corpus is printed
+	finalizers.run()
+	if *jsonOut || *format == "tap" || *quiet {
+		return
 	}
 
-	// print the contents of seed corpus entry files
-	err = filepath.WalkDir(".", func(
-		path string,
-		entry fs.DirEntry,
-		err error,
-	) error {
+	// print the contents of the seed corpus entry files of the targets that ran,
+	// rather than walking the whole tree for them
+	dirs := make([]string, 0, len(seedDirs))
+	for dir := range seedDirs {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	for _, dir := range dirs {
+		err = printCorpus(walkOpts, dir)
 		if err != nil {
-			return err
-		}
-		if entry.IsDir() {
-			return nil
-		}
-		if !strings.Contains(filepath.ToSlash(path), "/testdata/fuzz/") {
-			return nil
+			die(fmt.Errorf("could not walk dir: %w", err))
 		}
+	}
+}
+
+// printCorpus prints the contents of the corpus entry files under dir, if it exists
+func printCorpus(walkOpts walkOptions, dir string) error {
+	if _, err := os.Stat(dir); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return walkDir(walkOpts, dir, func(path string, entry fs.DirEntry) error {
 		file, err := os.Open(path)
 		if err != nil {
-			return fmt.Errorf(`could not open file "%s": %w`, path, err)
+			return walkOpts.check(fmt.Errorf(`could not open file "%s": %w`, path, err))
 		}
 		defer file.Close()
 		fmt.Printf("===== %s =====\n", path)
@@ -276,12 +1350,68 @@ func main() {
 		fmt.Println()
 		return nil
 	})
-	if err != nil {
-		die(fmt.Errorf("could not walk dir: %w", err))
+}
+
+// status returns the outcome of the result: pass, fail, broken, skip or cancelled.
+// a target that found a failing input before the run was cancelled still failed.
+// skipMessage returns why r was skipped
+func (r result) skipMessage() string {
+	if r.skipReason != "" {
+		return r.skipReason
+	}
+	return "not fuzzed"
+}
+
+func (r result) status() string {
+	switch {
+	case r.cancelled && r.input == "":
+		return "cancelled"
+	case r.broken:
+		return "broken"
+	case r.err != nil:
+		return "fail"
+	case r.skipped:
+		return "skip"
+	}
+	return "pass"
+}
+
+// end returns when the target finished, as measured from its start by the monotonic clock
+func (r result) end() time.Time {
+	return r.start.Add(r.duration).Round(0)
+}
+
+// record returns the stats DB record of the result
+func (r result) record() statsRecord {
+	return statsRecord{
+		Target:   r.fullpath,
+		Start:    r.start,
+		End:      r.end(),
+		Duration: r.duration,
+		CPU:      r.cpu,
+		Status:   r.status(),
+	}
+}
+
+// parseLabels parses the KEY=VALUE labels of -label
+func parseLabels(l []string) (map[string]string, error) {
+	if len(l) == 0 {
+		return nil, nil
+	}
+	labels := make(map[string]string, len(l))
+	for _, kv := range l {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf(`invalid label "%s"; must be of the form KEY=VALUE`, kv)
+		}
+		labels[k] = v
 	}
+	return labels, nil
 }
 
+// die logs v as an error, runs the finalizers and exits
 func die(v any) {
-	fmt.Println(v)
-	os.Exit(1)
+	logger.Error(fmt.Sprint(v))
+	finalizers.run()
+	os.Exit(exitBroken)
 }
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"strings"
+	"time"
+)
+
+// markdownReporter writes a markdown summary at the end of the run,
+// with a table of the targets and a list of the failing inputs found by the run,
+// as for $GITHUB_STEP_SUMMARY or a pull request comment
+type markdownReporter struct {
+	w       io.WriteCloser
+	results []result
+}
+
+func (m *markdownReporter) report(e event) error {
+	switch e.Type {
+	case eventTargetFinish:
+		m.results = append(m.results, *e.result)
+	case eventRunEnd:
+		return m.write(e)
+	}
+	return nil
+}
+
+// markdownEscape escapes text for a cell of a markdown table
+func markdownEscape(s string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ").Replace(s)
+}
+
+// write writes the summary
+func (m *markdownReporter) write(e event) error {
+	var b strings.Builder
+	b.WriteString("## gofuzz\n\n")
+	if s := e.Summary; s != nil {
+		fmt.Fprintf(&b, "%d targets: %d passed, %d failed, %d broken, %d skipped",
+			s.Total, s.Passed, s.Failed, s.Broken, s.Skipped)
+		if s.Cancelled > 0 {
+			fmt.Fprintf(&b, ", %d cancelled", s.Cancelled)
+		}
+		b.WriteString("\n\n")
+	}
+	if e.Status == "cancelled" {
+		fmt.Fprintf(&b, "> the run was cancelled (%s); results are partial\n\n", markdownEscape(e.Error))
+	}
+	if len(m.results) > 0 {
+		b.WriteString("| target | status | duration | failing input |\n")
+		b.WriteString("| --- | --- | ---: | --- |\n")
+		for _, r := range m.results {
+			input := ""
+			if r.input != "" {
+				input = "`" + markdownEscape(r.input) + "`"
+			}
+			fmt.Fprintf(&b, "| `%s` | %s | %s | %s |\n",
+				markdownEscape(r.fullpath), r.status(), r.duration.Round(time.Millisecond), input)
+		}
+		b.WriteString("\n")
+	}
+	// inputs that already were in the seed corpus aren't new
+	var crashers []result
+	for _, r := range m.results {
+		if r.input != "" && failingInputRgx.MatchString(r.output) {
+			crashers = append(crashers, r)
+		}
+	}
+	if len(crashers) > 0 {
+		b.WriteString("### new failing inputs\n\n")
+		for _, r := range crashers {
+			fmt.Fprintf(&b, "- `%s`: `%s`\n", markdownEscape(r.fullpath), markdownEscape(r.input))
+		}
+		b.WriteString("\n")
+	}
+	// the failures, collapsed, with just the parts of their output that matter
+	var failures strings.Builder
+	for _, r := range m.results {
+		x := r.excerpt()
+		if r.status() != "fail" || x == nil {
+			continue
+		}
+		summary := "<code>" + html.EscapeString(r.fullpath) + "</code>"
+		if x.Reason != "" {
+			summary += ": " + html.EscapeString(x.Reason)
+		}
+		fmt.Fprintf(&failures, "<details><summary>%s</summary>\n\n", summary)
+		if x.Input != "" {
+			fmt.Fprintf(&failures, "failing input:\n\n~~~\n%s\n~~~\n\n", x.Input)
+		}
+		if x.Fail != "" {
+			fmt.Fprintf(&failures, "~~~\n%s\n~~~\n\n", x.Fail)
+		}
+		failures.WriteString("</details>\n\n")
+	}
+	if len(e.Clusters) > 0 {
+		b.WriteString("### failures by crash site\n\n")
+		for _, c := range e.Clusters {
+			targets := make([]string, len(c.Targets))
+			for i, t := range c.Targets {
+				targets[i] = "`" + markdownEscape(t) + "`"
+			}
+			fmt.Fprintf(&b, "- `%s`: %s: %s\n", markdownEscape(c.Frame), c.hits(), strings.Join(targets, ", "))
+		}
+		b.WriteString("\n")
+	}
+	if failures.Len() > 0 {
+		b.WriteString("### failures\n\n")
+		b.WriteString(failures.String())
+	}
+	_, err := io.WriteString(m.w, b.String())
+	if err != nil {
+		return fmt.Errorf("could not write markdown summary: %w", err)
+	}
+	return nil
+}
+
+func (m *markdownReporter) close() error {
+	return m.w.Close()
+}
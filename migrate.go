@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/build/constraint"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const migrateHelpText = `Usage: gofuzz migrate [OPTIONS...]
+
+migrate finds legacy go-fuzz targets, which are functions of the form
+func Fuzz(data []byte) int in non-test files, and lists them.
+with -w, a native fuzz function named FuzzLegacy that calls the legacy target
+is written next to each of them, in a file named ` + migratedFile + `.
+the build constraint of the legacy target, if any, is copied to the wrapper,
+and a build tag it requires is passed to go test with a //gofuzz:args directive.
+the legacy targets can also still be run with go-fuzz-build and go-fuzz.
+
+Options:
+`
+
+// migratedFile is the name of the files that migrate writes
+const migratedFile = "gofuzz_migrated_test.go"
+
+// legacyTarget is a go-fuzz target
+type legacyTarget struct {
+	// path is the file the target is defined in
+	path string
+	pkg  string
+	// build is the build constraint of the file, if any
+	build constraint.Expr
+}
+
+// isLegacyFuzz reports whether fn has the signature of a go-fuzz target
+func isLegacyFuzz(fn *ast.FuncDecl) bool {
+	if fn.Name.Name != "Fuzz" || fn.Recv != nil {
+		return false
+	}
+	params, results := fn.Type.Params.List, fn.Type.Results
+	if len(params) != 1 || len(params[0].Names) > 1 || results == nil || len(results.List) != 1 {
+		return false
+	}
+	arr, ok := params[0].Type.(*ast.ArrayType)
+	if !ok || arr.Len != nil {
+		return false
+	}
+	elem, ok := arr.Elt.(*ast.Ident)
+	if !ok || elem.Name != "byte" {
+		return false
+	}
+	ret, ok := results.List[0].Type.(*ast.Ident)
+	return ok && ret.Name == "int" && len(results.List[0].Names) <= 1
+}
+
+// findLegacyTarget returns the go-fuzz target in the file at p, if any
+func findLegacyTarget(p string) (legacyTarget, bool, error) {
+	file, err := parser.ParseFile(token.NewFileSet(), p, nil, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil {
+		return legacyTarget{}, false, fmt.Errorf(`could not parse "%s": %w`, p, err)
+	}
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || !isLegacyFuzz(fn) {
+			continue
+		}
+		t := legacyTarget{path: p, pkg: file.Name.Name}
+		// build constraints come before the package clause
+		for _, group := range file.Comments {
+			if group.Pos() > file.Package {
+				break
+			}
+			for _, c := range group.List {
+				if constraint.IsGoBuild(c.Text) {
+					t.build, err = constraint.Parse(c.Text)
+					if err != nil {
+						return legacyTarget{}, false, fmt.Errorf(`invalid build constraint in "%s": %w`, p, err)
+					}
+				}
+			}
+		}
+		return t, true, nil
+	}
+	return legacyTarget{}, false, nil
+}
+
+// findLegacyTargets returns the go-fuzz targets under the current dir
+func findLegacyTargets(opts walkOptions) ([]legacyTarget, error) {
+	var targets []legacyTarget
+	err := walkTree(opts, func(p string, entry fs.DirEntry) error {
+		if !strings.HasSuffix(p, ".go") || strings.HasSuffix(p, "_test.go") {
+			return nil
+		}
+		t, ok, err := findLegacyTarget(p)
+		if err != nil {
+			return opts.check(err)
+		}
+		if ok {
+			targets = append(targets, t)
+		}
+		return nil
+	})
+	return targets, err
+}
+
+// wrapper returns the source of the native fuzz function that calls t
+func (t legacyTarget) wrapper() []byte {
+	var b bytes.Buffer
+	fmt.Fprintln(&b, "// Code generated by gofuzz migrate.")
+	fmt.Fprintln(&b)
+	if t.build != nil {
+		fmt.Fprintf(&b, "//go:build %s\n\n", t.build)
+	}
+	fmt.Fprintf(&b, "package %s\n\n", t.pkg)
+	fmt.Fprintln(&b, `import "testing"`)
+	fmt.Fprintln(&b)
+	fmt.Fprintln(&b, "// FuzzLegacy runs the go-fuzz target Fuzz as a native fuzz test")
+	// a constraint that is a single tag is most likely the gofuzz tag,
+	// without which the legacy target isn't built
+	if tag, ok := t.build.(*constraint.TagExpr); ok {
+		fmt.Fprintf(&b, "%s -tags=%s\n", argsDirective, tag.Tag)
+	}
+	fmt.Fprintln(&b, "func FuzzLegacy(f *testing.F) {")
+	fmt.Fprintln(&b, "\tf.Fuzz(func(t *testing.T, data []byte) {")
+	fmt.Fprintln(&b, "\t\tFuzz(data)")
+	fmt.Fprintln(&b, "\t})")
+	fmt.Fprintln(&b, "}")
+	return b.Bytes()
+}
+
+// migrateCmd implements the migrate subcommand
+func migrateCmd(args []string) {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, migrateHelpText)
+		flags.PrintDefaults()
+	}
+	root := flags.String("root", ".", "root dir of the go project")
+	write := flags.Bool("w", false, "write native fuzz wrappers for the legacy targets")
+	flags.Parse(args)
+	if flags.NArg() != 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	err := os.Chdir(*root)
+	if err != nil {
+		die(err)
+	}
+	targets, err := findLegacyTargets(walkOptions{})
+	if err != nil {
+		die(err)
+	}
+	if len(targets) == 0 {
+		fmt.Println("no go-fuzz targets found.")
+		return
+	}
+	for _, t := range targets {
+		if !*write {
+			fmt.Println(t.path)
+			continue
+		}
+		p := filepath.Join(filepath.Dir(t.path), migratedFile)
+		file, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if errors.Is(err, fs.ErrExist) {
+			fmt.Fprintf(os.Stderr, "warning: not overwriting \"%s\"\n", p)
+			continue
+		}
+		if err != nil {
+			die(fmt.Errorf(`could not create "%s": %w`, p, err))
+		}
+		_, err = file.Write(t.wrapper())
+		if err == nil {
+			err = file.Close()
+		}
+		if err != nil {
+			die(fmt.Errorf(`could not write "%s": %w`, p, err))
+		}
+		fmt.Printf("%s: wrote %s\n", t.path, p)
+	}
+}
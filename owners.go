@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// codeownersPaths are where a CODEOWNERS file is looked for, in order
+var codeownersPaths = []string{"CODEOWNERS", ".github/CODEOWNERS", "docs/CODEOWNERS", ".gitlab/CODEOWNERS"}
+
+// ownerRule is a line of a CODEOWNERS file
+type ownerRule struct {
+	rgx    *regexp.Regexp
+	owners []string
+}
+
+// ownerMap maps file paths to their owners, as in a CODEOWNERS file
+type ownerMap struct {
+	rules []ownerRule
+}
+
+// ownerPattern converts a CODEOWNERS pattern to a regexp matching slash-separated paths.
+// a pattern containing a slash other than a trailing one is relative to the root,
+// and any other pattern matches at any depth. a pattern matching a dir matches everything in it.
+func ownerPattern(ptrn string) (*regexp.Regexp, error) {
+	dirOnly := strings.HasSuffix(ptrn, "/")
+	ptrn = strings.TrimSuffix(ptrn, "/")
+	anchored := strings.Contains(ptrn, "/")
+	ptrn = strings.TrimPrefix(ptrn, "/")
+	var b strings.Builder
+	b.WriteString("^")
+	if !anchored {
+		b.WriteString("(.*/)?")
+	}
+	for i := 0; i < len(ptrn); i++ {
+		switch c := ptrn[i]; {
+		case c == '*' && i+1 < len(ptrn) && ptrn[i+1] == '*':
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	if dirOnly {
+		b.WriteString("/.*$")
+	} else {
+		b.WriteString("(/.*)?$")
+	}
+	return regexp.Compile(b.String())
+}
+
+// loadOwners reads the CODEOWNERS file at p.
+// if p is empty, the file is looked for in the usual places under the current dir,
+// and a nil map is returned if there is none.
+func loadOwners(p string) (*ownerMap, error) {
+	if p == "" {
+		for _, candidate := range codeownersPaths {
+			_, err := os.Stat(candidate)
+			if err == nil {
+				p = candidate
+				break
+			}
+		}
+		if p == "" {
+			return nil, nil
+		}
+	}
+	file, err := os.Open(p)
+	if err != nil {
+		return nil, fmt.Errorf(`could not open owners file "%s": %w`, p, err)
+	}
+	defer file.Close()
+	m := &ownerMap{}
+	sc := bufio.NewScanner(file)
+	for n := 1; sc.Scan(); n++ {
+		line, _, _ := strings.Cut(sc.Text(), "#")
+		fields := strings.Fields(line)
+		// sections of gitlab CODEOWNERS files, as in [Section] @owner
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "[") || strings.HasPrefix(fields[0], "^[") {
+			continue
+		}
+		rgx, err := ownerPattern(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf(`invalid pattern on line %d of owners file "%s": %w`, n, p, err)
+		}
+		m.rules = append(m.rules, ownerRule{rgx: rgx, owners: fields[1:]})
+	}
+	err = sc.Err()
+	if err != nil {
+		return nil, fmt.Errorf(`could not scan owners file "%s": %w`, p, err)
+	}
+	return m, nil
+}
+
+// owners returns the owners of the file at the slash-separated path p.
+// the last matching rule wins, and a rule without owners makes the file unowned.
+func (m *ownerMap) owners(p string) []string {
+	for i := len(m.rules) - 1; i >= 0; i-- {
+		if m.rules[i].rgx.MatchString(p) {
+			return m.rules[i].owners
+		}
+	}
+	return nil
+}
+
+// ownedBy reports whether any of owners is one of want.
+// an owner also matches by its name alone, so team-x matches @org/team-x.
+func ownedBy(owners []string, want []string) bool {
+	for _, owner := range owners {
+		name := strings.TrimPrefix(owner, "@")
+		if i := strings.LastIndex(name, "/"); i >= 0 {
+			name = name[i+1:]
+		}
+		for _, w := range want {
+			if w == owner || w == name || strings.TrimPrefix(w, "@") == strings.TrimPrefix(owner, "@") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// assignOwners sets the owners of every target read from targets.
+// if want isn't empty, only targets owned by one of want are kept.
+func assignOwners(targets <-chan fuzz, m *ownerMap, want []string) <-chan fuzz {
+	out := make(chan fuzz, cap(targets))
+	go func() {
+		defer close(out)
+		for f := range targets {
+			f.owners = m.owners(f.file)
+			if len(want) > 0 && !ownedBy(f.owners, want) {
+				continue
+			}
+			out <- f
+		}
+	}()
+	return out
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const planHelpText = `Usage: gofuzz plan -shards M -o FILE [OPTIONS...] [-- GOTESTARGS...]
+       gofuzz run -plan FILE -shard K [OPTIONS...] [-- GOTESTARGS...]
+
+plan selects the targets as a run with the same OPTIONS and GOTESTARGS
+would, and writes a manifest to FILE that assigns them to M shards, along
+with the -fuzztime of each target and how long it's expected to take, so
+that ci can run the shards as separate jobs. the targets are assigned so
+that the shards are expected to take about as long as each other, and the
+same targets and options always make the same plan.
+the expected durations are the average durations of the targets in the
+stats DB specified by -stats-dir, if any, and their -fuzztime otherwise.
+
+run -plan FILE -shard K runs the targets of the K-th shard of the plan,
+from 1 to M, in the order of the plan and with its -fuzztime, without
+selecting them again.
+`
+
+// runPlan is a manifest that assigns targets to shards, which are run separately
+type runPlan struct {
+	Shards      int         `json:"shards"`
+	Assignments []planShard `json:"assignments"`
+}
+
+// planShard is the targets that a shard of a plan runs
+type planShard struct {
+	Shard int `json:"shard"`
+	// Expected is how long the targets of the shard are expected to take in total
+	Expected time.Duration   `json:"expected"`
+	Targets  []plannedTarget `json:"targets"`
+}
+
+// plannedTarget is a target of a plan
+type plannedTarget struct {
+	Target string `json:"target"`
+	// Fuzztime is the -fuzztime that the target is run with, if any
+	Fuzztime string `json:"fuzztime,omitempty"`
+	// Expected is how long the target is expected to take, or zero if that's not known
+	Expected time.Duration `json:"expected,omitempty"`
+}
+
+// planArgs implements the plan subcommand.
+// it takes -shards and -o out of args, and returns the args to run gofuzz with,
+// which make it write the plan rather than run the targets.
+func planArgs(args []string) []string {
+	var rest []string
+	shards, out := 0, ""
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			rest = append(rest, args[i:]...)
+			break
+		}
+		name, value, ok := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || (name != "shards" && name != "o") {
+			if name == "h" || name == "help" {
+				fmt.Fprint(os.Stderr, planHelpText)
+				os.Exit(2)
+			}
+			rest = append(rest, arg)
+			continue
+		}
+		if !ok {
+			if i+1 >= len(args) {
+				die(fmt.Sprintf("-%s requires a value.", name))
+			}
+			i++
+			value = args[i]
+		}
+		if name == "o" {
+			out = value
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			die(fmt.Sprintf(`invalid -shards value "%s".`, value))
+		}
+		shards = n
+	}
+	if shards == 0 || out == "" {
+		fmt.Fprint(os.Stderr, planHelpText)
+		os.Exit(2)
+	}
+	return append([]string{"-write-plan=" + out, "-plan-shards=" + strconv.Itoa(shards)}, rest...)
+}
+
+// makePlan assigns targets to the given number of shards.
+// the targets are taken longest first, each by the shard that is expected to finish first,
+// so that the shards take about as long as each other.
+// the -fuzztime of a target is that of goTestArgs, overridden by its own args.
+func makePlan(targets []fuzz, shards int, goTestArgs []string, recs []statsRecord) runPlan {
+	expected := averageDurations(recs)
+	planned := make([]plannedTarget, len(targets))
+	for i, f := range targets {
+		fuzztime := fuzztimeArg(append(append([]string{}, goTestArgs...), f.args...))
+		d, ok := expected[f.fullpath]
+		if !ok {
+			d = fuzztimeDuration(fuzztime)
+		}
+		planned[i] = plannedTarget{Target: f.fullpath, Fuzztime: fuzztime, Expected: d}
+	}
+	sort.SliceStable(planned, func(i, j int) bool {
+		if planned[i].Expected != planned[j].Expected {
+			return planned[i].Expected > planned[j].Expected
+		}
+		return planned[i].Target < planned[j].Target
+	})
+	plan := runPlan{Shards: shards, Assignments: make([]planShard, shards)}
+	for i := range plan.Assignments {
+		plan.Assignments[i].Shard = i + 1
+	}
+	for _, t := range planned {
+		least := 0
+		for i, s := range plan.Assignments {
+			if s.load() < plan.Assignments[least].load() {
+				least = i
+			}
+		}
+		s := &plan.Assignments[least]
+		s.Targets = append(s.Targets, t)
+		s.Expected += t.Expected
+	}
+	return plan
+}
+
+// load is how long the shard is expected to take, counting the targets of unknown duration
+// as a second each, so that they are spread out too
+func (s planShard) load() time.Duration {
+	load := s.Expected
+	for _, t := range s.Targets {
+		if t.Expected == 0 {
+			load += time.Second
+		}
+	}
+	return load
+}
+
+// averageDurations returns the average duration of the passing runs of each target in recs
+func averageDurations(recs []statsRecord) map[string]time.Duration {
+	total := make(map[string]time.Duration)
+	count := make(map[string]int)
+	for _, rec := range recs {
+		if rec.Status != "pass" {
+			continue
+		}
+		total[rec.Target] += rec.Duration
+		count[rec.Target]++
+	}
+	avg := make(map[string]time.Duration, len(total))
+	for target, d := range total {
+		avg[target] = (d / time.Duration(count[target])).Round(time.Second)
+	}
+	return avg
+}
+
+// writePlan writes plan to the file at p
+func writePlan(p string, plan runPlan) error {
+	data, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(p, append(data, '\n'), 0o644)
+	if err != nil {
+		return fmt.Errorf(`could not write plan "%s": %w`, p, err)
+	}
+	return nil
+}
+
+// readPlan reads the plan file at p
+func readPlan(p string) (*runPlan, error) {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, fmt.Errorf(`could not read plan "%s": %w`, p, err)
+	}
+	var plan runPlan
+	err = json.Unmarshal(data, &plan)
+	if err != nil {
+		return nil, fmt.Errorf(`invalid plan "%s": %w`, p, err)
+	}
+	return &plan, nil
+}
+
+// schedule returns the schedule that runs the k-th shard of the plan, counting from 1
+func (p *runPlan) schedule(k int) (*runSchedule, error) {
+	for _, s := range p.Assignments {
+		if s.Shard != k {
+			continue
+		}
+		sched := &runSchedule{}
+		for _, t := range s.Targets {
+			st := scheduledTarget{Target: t.Target}
+			if t.Fuzztime != "" {
+				st.Args = []string{"-fuzztime=" + t.Fuzztime}
+			}
+			sched.Targets = append(sched.Targets, st)
+		}
+		return sched, nil
+	}
+	return nil, fmt.Errorf("the plan has no shard %d; its shards are numbered from 1 to %d", k, p.Shards)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// eventSchedule is sent to plugins before a target is started.
+// unlike other events, plugins must respond to it.
+const eventSchedule = "schedule"
+
+// decision is a plugin's response to a schedule event
+type decision struct {
+	// Skip makes the target not be run
+	Skip bool `json:"skip"`
+	// Fuzztime overrides the -fuzztime of the target
+	Fuzztime string `json:"fuzztime"`
+	// Reason explains the decision
+	Reason string `json:"reason"`
+}
+
+// plugin is an external command that receives the json event stream on stdin,
+// and answers every schedule event with a json decision line on stdout.
+// it also acts as a reporter, so it sees every other event as well.
+type plugin struct {
+	mu     sync.Mutex
+	run    string
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	enc    *json.Encoder
+	stdout *bufio.Scanner
+	// broken is set once writing an event to the plugin has failed,
+	// so that a dead plugin doesn't produce an error per event.
+	// the run fails at the next schedule event instead, which the plugin can't answer.
+	broken bool
+}
+
+// newPlugin starts the given command, which is split with splitCommand
+func newPlugin(command string, run string) (*plugin, error) {
+	args, err := splitCommand(command)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return nil, errors.New("empty plugin command")
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	err = cmd.Start()
+	if err != nil {
+		return nil, fmt.Errorf(`could not start plugin "%s": %w`, command, err)
+	}
+	return &plugin{
+		run:    run,
+		cmd:    cmd,
+		stdin:  stdin,
+		enc:    json.NewEncoder(stdin),
+		stdout: bufio.NewScanner(stdout),
+	}, nil
+}
+
+func (p *plugin) report(e event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.broken {
+		return nil
+	}
+	err := p.enc.Encode(e)
+	if err != nil {
+		p.broken = true
+		return fmt.Errorf(`could not write to plugin "%s": %w`, p.cmd.Path, err)
+	}
+	return nil
+}
+
+// schedule asks the plugin what to do with f
+func (p *plugin) schedule(f fuzz) (decision, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	e := fuzzEvent(eventSchedule, f)
+	e.Run = p.run
+	e.Time = time.Now()
+	err := p.enc.Encode(e)
+	if err != nil {
+		return decision{}, fmt.Errorf(`could not write to plugin "%s": %w`, p.cmd.Path, err)
+	}
+	if !p.stdout.Scan() {
+		err := p.stdout.Err()
+		if err == nil {
+			err = io.ErrUnexpectedEOF
+		}
+		return decision{}, fmt.Errorf(`could not read from plugin "%s": %w`, p.cmd.Path, err)
+	}
+	var d decision
+	err = json.Unmarshal(p.stdout.Bytes(), &d)
+	if err != nil {
+		return decision{}, fmt.Errorf(`invalid response from plugin "%s": %w`, p.cmd.Path, err)
+	}
+	if d.Fuzztime != "" && strings.ContainsAny(d.Fuzztime, " \t\n") {
+		return decision{}, fmt.Errorf(`invalid fuzztime "%s" from plugin "%s"`, d.Fuzztime, p.cmd.Path)
+	}
+	return d, nil
+}
+
+func (p *plugin) close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stdin.Close()
+	// drain stdout so the plugin doesn't block on writing to it
+	for p.stdout.Scan() {
+	}
+	err := p.cmd.Wait()
+	if err != nil {
+		return fmt.Errorf(`plugin "%s" failed: %w`, p.cmd.Path, err)
+	}
+	return nil
+}
+
+// schedule asks every plugin what to do with f, and combines their decisions.
+// f is skipped if any plugin says so, and later plugins override the fuzztime of earlier ones.
+func schedule(plugins []*plugin, f fuzz) (decision, error) {
+	var combined decision
+	var reasons []string
+	for _, p := range plugins {
+		d, err := p.schedule(f)
+		if err != nil {
+			return decision{}, err
+		}
+		if d.Skip {
+			combined.Skip = true
+		}
+		if d.Fuzztime != "" {
+			combined.Fuzztime = d.Fuzztime
+		}
+		if d.Reason != "" {
+			reasons = append(reasons, d.Reason)
+		}
+	}
+	combined.Reason = strings.Join(reasons, "; ")
+	return combined, nil
+}
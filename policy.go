@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// failure categories, which -fail-on chooses from
+const (
+	categoryCrash  = "crash"
+	categoryRace   = "race"
+	categoryHang   = "hang"
+	categoryError  = "error"
+	categoryBroken = "broken"
+	// categoryQuarantined isn't a category of its own, but makes the failures of quarantined targets count
+	categoryQuarantined = "quarantined"
+)
+
+// defaultFailOn is the default -fail-on, which is every category except the quarantined targets
+const defaultFailOn = "crash,race,hang,error,broken"
+
+// raceWarning is what the race detector prints when it finds a data race
+const raceWarning = "WARNING: DATA RACE"
+
+// failurePolicy is the set of failure categories that fail the run
+type failurePolicy map[string]bool
+
+// parseFailurePolicy parses a comma-separated -fail-on list
+func parseFailurePolicy(s string) (failurePolicy, error) {
+	p := make(failurePolicy)
+	for _, c := range strings.Split(s, ",") {
+		c = strings.TrimSpace(c)
+		switch c {
+		case "":
+		case categoryCrash, categoryRace, categoryHang, categoryError, categoryBroken, categoryQuarantined:
+			p[c] = true
+		default:
+			return nil, fmt.Errorf(`unknown failure category "%s"`, c)
+		}
+	}
+	return p, nil
+}
+
+// fails reports whether r fails the run according to the policy
+func (p failurePolicy) fails(r result) bool {
+	category := r.category()
+	if category == "" {
+		return false
+	}
+	if r.quarantined && !p[categoryQuarantined] {
+		return false
+	}
+	return p[category]
+}
+
+// category returns the failure category of r, or an empty string if r didn't fail.
+// a target that was cancelled without having failed didn't fail.
+func (r result) category() string {
+	switch r.status() {
+	case "broken":
+		return categoryBroken
+	case "fail":
+	default:
+		return ""
+	}
+	switch {
+	case strings.Contains(r.output, raceWarning):
+		return categoryRace
+	case r.hung():
+		return categoryHang
+	case strings.Contains(r.output, "panic: "):
+		return categoryCrash
+	}
+	return categoryError
+}
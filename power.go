@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// powerPollInterval is how often the power state is checked while fuzzing is paused
+const powerPollInterval = 30 * time.Second
+
+// waitForPower blocks while the machine runs on battery or is thermally throttled,
+// as reported by powerConstrained, or until ctx is done
+func waitForPower(ctx context.Context) {
+	reason := powerConstrained()
+	if reason == "" {
+		return
+	}
+	logger.Info("pausing fuzzing", "reason", reason)
+	ticker := time.NewTicker(powerPollInterval)
+	defer ticker.Stop()
+	for reason != "" {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		reason = powerConstrained()
+	}
+	logger.Info("resuming fuzzing")
+}
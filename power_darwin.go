@@ -0,0 +1,33 @@
+package main
+
+import (
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// cpuSpeedLimitRgx matches the cpu speed limit in the output of pmset -g therm,
+// which drops below 100 when the cpu is thermally throttled
+var cpuSpeedLimitRgx = regexp.MustCompile(`CPU_Speed_Limit\s*=\s*(\d+)`)
+
+// powerConstrained returns why fuzzing should pause, if the machine runs on battery
+// or its cpu is thermally throttled, according to pmset.
+// it returns an empty string otherwise.
+func powerConstrained() string {
+	out, err := exec.Command("pmset", "-g", "batt").Output()
+	if err == nil && strings.Contains(string(out), "'Battery Power'") {
+		return "on battery"
+	}
+	out, err = exec.Command("pmset", "-g", "therm").Output()
+	if err != nil {
+		return ""
+	}
+	if m := cpuSpeedLimitRgx.FindSubmatch(out); m != nil {
+		limit, err := strconv.Atoi(string(m[1]))
+		if err == nil && limit < 100 {
+			return "thermal pressure, cpu speed limited to " + string(m[1]) + "%"
+		}
+	}
+	return ""
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// readSysfs returns the trimmed contents of a sysfs file, or an empty string
+func readSysfs(p string) string {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// powerConstrained returns why fuzzing should pause, if the machine is discharging
+// its battery or any thermal zone is at or above its passive trip point,
+// where the kernel starts throttling the cpu. it returns an empty string otherwise.
+func powerConstrained() string {
+	supplies, _ := filepath.Glob("/sys/class/power_supply/*")
+	for _, dir := range supplies {
+		if readSysfs(filepath.Join(dir, "type")) == "Battery" &&
+			readSysfs(filepath.Join(dir, "status")) == "Discharging" {
+			return "on battery"
+		}
+	}
+	zones, _ := filepath.Glob("/sys/class/thermal/thermal_zone*")
+	for _, dir := range zones {
+		temp, err := strconv.Atoi(readSysfs(filepath.Join(dir, "temp")))
+		if err != nil {
+			continue
+		}
+		types, _ := filepath.Glob(filepath.Join(dir, "trip_point_*_type"))
+		for _, p := range types {
+			if readSysfs(p) != "passive" {
+				continue
+			}
+			trip, err := strconv.Atoi(readSysfs(strings.TrimSuffix(p, "_type") + "_temp"))
+			if err == nil && trip > 0 && temp >= trip {
+				return "thermal pressure in " + readSysfs(filepath.Join(dir, "type"))
+			}
+		}
+	}
+	return ""
+}
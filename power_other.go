@@ -0,0 +1,9 @@
+//go:build !linux && !darwin
+
+package main
+
+// powerConstrained always returns an empty string,
+// as the power state isn't known on this platform
+func powerConstrained() string {
+	return ""
+}
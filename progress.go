@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// targetCount counts the targets of a run as they are discovered
+type targetCount struct {
+	mu sync.Mutex
+	n  int
+	// done is set once every target has been discovered
+	done bool
+}
+
+// count counts the targets read from targets
+func (c *targetCount) count(targets <-chan fuzz) <-chan fuzz {
+	out := make(chan fuzz, cap(targets))
+	go func() {
+		defer close(out)
+		for f := range targets {
+			c.mu.Lock()
+			c.n++
+			c.mu.Unlock()
+			out <- f
+		}
+		c.mu.Lock()
+		c.done = true
+		c.mu.Unlock()
+	}()
+	return out
+}
+
+// get returns the number of targets so far, and whether that is all of them
+func (c *targetCount) get() (int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.n, c.done
+}
+
+// fuzztimeArg returns the value of the last -fuzztime in go test args, if any
+func fuzztimeArg(args []string) string {
+	v := ""
+	for i, arg := range args {
+		name, value, ok := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || (name != "fuzztime" && name != "test.fuzztime") {
+			continue
+		}
+		if !ok && i+1 < len(args) {
+			value = args[i+1]
+		}
+		v = value
+	}
+	return v
+}
+
+// fuzztimeDuration returns the duration of a -fuzztime value,
+// or zero if its duration isn't known, as with a number of executions such as 1000x
+func fuzztimeDuration(v string) time.Duration {
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0
+	}
+	return d
+}
+
+// progressReporter prints how many of the targets have finished after each one does,
+// and an estimate of the time left, which is based on the -fuzztime of the targets
+// and on how many run in parallel, or on how long the finished targets took
+type progressReporter struct {
+	w        io.Writer
+	targets  *targetCount
+	parallel int
+	// fuzztime is the -fuzztime of the targets that haven't started yet, if known
+	fuzztime time.Duration
+	running  map[string]progressTarget
+	finished int
+	// took is the total duration of the finished targets
+	took time.Duration
+}
+
+// progressTarget is a running target, as tracked by the progress reporter
+type progressTarget struct {
+	start    time.Time
+	fuzztime time.Duration
+}
+
+func (p *progressReporter) report(e event) error {
+	switch e.Type {
+	case eventTargetStart:
+		if p.running == nil {
+			p.running = make(map[string]progressTarget)
+		}
+		p.running[e.Target] = progressTarget{start: e.Time, fuzztime: fuzztimeDuration(e.Fuzztime)}
+	case eventTargetFinish:
+		delete(p.running, e.Target)
+		p.finished++
+		p.took += e.Duration
+		return p.print(e.Time)
+	}
+	return nil
+}
+
+// print prints the progress line
+func (p *progressReporter) print(now time.Time) error {
+	total, done := p.targets.get()
+	of := fmt.Sprint(total)
+	if !done {
+		of = "at least " + of
+	}
+	line := fmt.Sprintf("progress: %d of %s targets finished, %d running", p.finished, of, len(p.running))
+	if left, ok := p.estimate(now, total); ok && (!done || p.finished < total) {
+		if !done {
+			line += fmt.Sprintf(", at least %s left", left.Round(time.Second))
+		} else {
+			line += fmt.Sprintf(", about %s left", left.Round(time.Second))
+		}
+	}
+	_, err := fmt.Fprintln(p.w, line)
+	return err
+}
+
+// estimate returns the time that the rest of the run is expected to take.
+// targets are expected to fuzz for their -fuzztime, or else for as long as
+// the finished ones did on average, and to share the parallel slots evenly.
+func (p *progressReporter) estimate(now time.Time, total int) (time.Duration, bool) {
+	var average time.Duration
+	if p.finished > 0 {
+		average = p.took / time.Duration(p.finished)
+	}
+	var work time.Duration
+	for _, t := range p.running {
+		expected := t.fuzztime
+		if expected == 0 {
+			expected = average
+		}
+		if expected == 0 {
+			return 0, false
+		}
+		work += max(expected-now.Sub(t.start), 0)
+	}
+	queued := max(total-p.finished-len(p.running), 0)
+	if queued > 0 {
+		expected := p.fuzztime
+		if expected == 0 {
+			expected = average
+		}
+		if expected == 0 {
+			return 0, false
+		}
+		work += time.Duration(queued) * expected
+	}
+	return work / time.Duration(max(p.parallel, 1)), true
+}
+
+func (p *progressReporter) close() error {
+	return nil
+}
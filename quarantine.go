@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const quarantineHelpText = `Usage: gofuzz quarantine add [OPTIONS...] -reason REASON TARGET...
+       gofuzz quarantine remove [OPTIONS...] TARGET...
+       gofuzz quarantine list [OPTIONS...]
+
+quarantine maintains the quarantine file, which lists targets such as
+path/to/package/FuzzFuncName that are known to fail, along with why
+and until when. regular runs leave quarantined targets out, and runs with
+-include-quarantined fuzz them without failing because of them, as for
+non-blocking nightly runs. once a quarantine expires, runs warn about it
+and the target counts again.
+
+Options:
+`
+
+// defaultQuarantineFile is the quarantine file under the root dir that is used by default
+const defaultQuarantineFile = ".gofuzz-quarantine.json"
+
+// quarantineEntry is a quarantined target
+type quarantineEntry struct {
+	Target string    `json:"target"`
+	Reason string    `json:"reason"`
+	Added  time.Time `json:"added"`
+	// Expires is when the quarantine ends, or nil if it doesn't
+	Expires *time.Time `json:"expires,omitempty"`
+}
+
+// expired reports whether the quarantine has ended by now
+func (q quarantineEntry) expired(now time.Time) bool {
+	return q.Expires != nil && now.After(*q.Expires)
+}
+
+// quarantineList is the contents of a quarantine file
+type quarantineList struct {
+	Targets []quarantineEntry `json:"targets"`
+}
+
+// loadQuarantine reads the quarantine file at p. a missing file is treated as empty.
+func loadQuarantine(p string) (*quarantineList, error) {
+	q := &quarantineList{}
+	data, err := os.ReadFile(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return q, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf(`could not read quarantine file "%s": %w`, p, err)
+	}
+	err = json.Unmarshal(data, q)
+	if err != nil {
+		return nil, fmt.Errorf(`invalid quarantine file "%s": %w`, p, err)
+	}
+	return q, nil
+}
+
+// save writes the quarantine file at p, with the targets sorted
+func (q *quarantineList) save(p string) error {
+	sort.Slice(q.Targets, func(i, j int) bool {
+		return q.Targets[i].Target < q.Targets[j].Target
+	})
+	data, err := json.MarshalIndent(q, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(p, append(data, '\n'), 0o644)
+	if err != nil {
+		return fmt.Errorf(`could not write quarantine file "%s": %w`, p, err)
+	}
+	return nil
+}
+
+// active returns the targets whose quarantine hasn't expired,
+// and warns about those whose quarantine has
+func (q *quarantineList) active(now time.Time) map[string]bool {
+	active := make(map[string]bool)
+	for _, e := range q.Targets {
+		if e.expired(now) {
+			logger.Warn("quarantine expired, so the target counts again. fix it, or extend or remove the quarantine",
+				"target", e.Target, "expired", e.Expires.Format(time.DateOnly), "reason", e.Reason)
+			continue
+		}
+		active[e.Target] = true
+	}
+	return active
+}
+
+// quarantineTargets marks the targets read from targets that are quarantined.
+// unless include is set, quarantined targets are left out instead.
+func quarantineTargets(targets <-chan fuzz, quarantined map[string]bool, include bool) <-chan fuzz {
+	out := make(chan fuzz, cap(targets))
+	go func() {
+		defer close(out)
+		for f := range targets {
+			if quarantined[f.fullpath] {
+				if !include {
+					logger.Info("skipping quarantined target", "target", f.fullpath)
+					continue
+				}
+				f.quarantined = true
+			}
+			out <- f
+		}
+	}()
+	return out
+}
+
+// quarantineCmd implements the quarantine subcommand
+func quarantineCmd(args []string) {
+	flags := flag.NewFlagSet("quarantine", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, quarantineHelpText)
+		flags.PrintDefaults()
+	}
+	root := flags.String("root", ".", "root dir of the go project")
+	file := flags.String("file", defaultQuarantineFile, "quarantine file, relative to -root")
+	reason := flags.String("reason", "", "why the targets are quarantined, such as a link to an issue; required by add")
+	expires := flags.String("expires", "", "date on which the quarantine of the targets ends, as in 2006-01-02; never if empty")
+	if len(args) == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	sub := args[0]
+	flags.Parse(args[1:])
+	p := filepath.Join(*root, *file)
+	q, err := loadQuarantine(p)
+	if err != nil {
+		die(err)
+	}
+	now := time.Now()
+	switch sub {
+	case "add":
+		if flags.NArg() == 0 {
+			die("no targets given.")
+		}
+		if *reason == "" {
+			die("-reason is required.")
+		}
+		var until *time.Time
+		if *expires != "" {
+			day, err := time.ParseInLocation(time.DateOnly, *expires, time.Local)
+			if err != nil {
+				die(fmt.Errorf("invalid -expires: %w", err))
+			}
+			// the quarantine lasts through the given day
+			end := day.AddDate(0, 0, 1).Add(-time.Second)
+			until = &end
+		}
+		for _, target := range flags.Args() {
+			entry := quarantineEntry{Target: target, Reason: *reason, Added: now.UTC(), Expires: until}
+			replaced := false
+			for i := range q.Targets {
+				if q.Targets[i].Target == target {
+					q.Targets[i] = entry
+					replaced = true
+				}
+			}
+			if !replaced {
+				q.Targets = append(q.Targets, entry)
+			}
+		}
+	case "remove":
+		if flags.NArg() == 0 {
+			die("no targets given.")
+		}
+		for _, target := range flags.Args() {
+			found := false
+			for i := range q.Targets {
+				if q.Targets[i].Target == target {
+					q.Targets = append(q.Targets[:i], q.Targets[i+1:]...)
+					found = true
+					break
+				}
+			}
+			if !found {
+				die(fmt.Sprintf("%s is not quarantined.", target))
+			}
+		}
+	case "list":
+		for _, e := range q.Targets {
+			until := "no expiry"
+			if e.Expires != nil {
+				until = "until " + e.Expires.Format(time.DateOnly)
+				if e.expired(now) {
+					until = "EXPIRED on " + e.Expires.Format(time.DateOnly)
+				}
+			}
+			fmt.Printf("%s\t%s\t%s\n", e.Target, until, e.Reason)
+		}
+		return
+	default:
+		flags.Usage()
+		os.Exit(2)
+	}
+	err = q.save(p)
+	if err != nil {
+		die(err)
+	}
+}
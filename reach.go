@@ -0,0 +1,200 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// codeGraph is a syntactic call graph of the go code in the tree.
+// calls are resolved by name only, without type checking:
+// a method call may be any method of that name in the tree,
+// so the graph over-approximates what is actually reachable.
+// code outside the tree, such as the standard library, isn't part of it.
+type codeGraph struct {
+	// funcs are the funcs of the tree by their key,
+	// which is the import path of their package followed by their name, or by their receiver type and name
+	funcs map[string]*funcNode
+	// methods are the keys of the methods of the tree by their name
+	methods map[string][]string
+}
+
+// funcNode is a func in the code graph
+type funcNode struct {
+	// stmts is the number of statements in the body of the func
+	stmts int
+	// refs are the funcs that the func calls or otherwise refers to
+	refs []funcRef
+}
+
+// funcRef is a reference to a func, which is resolved once every package is parsed
+type funcRef struct {
+	// pkg is the import path of the package of the func, or empty for a method
+	pkg  string
+	name string
+}
+
+// buildCodeGraph parses the go files in the tree, including the test files.
+// files that can't be parsed are left out.
+func buildCodeGraph(opts walkOptions) (*codeGraph, error) {
+	g := &codeGraph{
+		funcs:   make(map[string]*funcNode),
+		methods: make(map[string][]string),
+	}
+	importPaths := make(map[string]string)
+	err := walkTree(opts, func(p string, entry fs.DirEntry) error {
+		if !strings.HasSuffix(p, ".go") {
+			return nil
+		}
+		dir := path.Dir(filepath.ToSlash(p))
+		importPath, ok := importPaths[dir]
+		if !ok {
+			importPath, _ = importPathOf(dir)
+			importPaths[dir] = importPath
+		}
+		if importPath == "" {
+			return nil
+		}
+		g.addFile(p, importPath)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// addFile adds the funcs of the go file at p, which is in the package at importPath
+func (g *codeGraph) addFile(p string, importPath string) {
+	file, err := parser.ParseFile(token.NewFileSet(), p, nil, parser.SkipObjectResolution)
+	if err != nil {
+		logger.Debug("could not parse file, leaving it out of the call graph", "file", p, "err", err)
+		return
+	}
+	// imports are by the name they are referred to as in the file
+	imports := make(map[string]string)
+	for _, spec := range file.Imports {
+		p, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+		name := path.Base(p)
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		imports[name] = p
+	}
+	for _, decl := range file.Decls {
+		fd, ok := decl.(*ast.FuncDecl)
+		if !ok || fd.Body == nil {
+			continue
+		}
+		key := importPath + "." + fd.Name.Name
+		if fd.Recv != nil && len(fd.Recv.List) > 0 {
+			key = importPath + "." + recvName(fd.Recv.List[0].Type) + "." + fd.Name.Name
+			g.methods[fd.Name.Name] = append(g.methods[fd.Name.Name], key)
+		}
+		// an external test package shares the import path of the package it tests,
+		// so a func may be defined in both
+		node := g.funcs[key]
+		if node == nil {
+			node = &funcNode{}
+			g.funcs[key] = node
+		}
+		var visit func(n ast.Node) bool
+		visit = func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.BlockStmt:
+			case ast.Stmt:
+				node.stmts++
+			case *ast.SelectorExpr:
+				if x, ok := n.X.(*ast.Ident); ok && imports[x.Name] != "" {
+					node.refs = append(node.refs, funcRef{pkg: imports[x.Name], name: n.Sel.Name})
+					return false
+				}
+				// the selected name is a method or a field, not a func of this package
+				node.refs = append(node.refs, funcRef{name: n.Sel.Name})
+				ast.Inspect(n.X, visit)
+				return false
+			case *ast.Ident:
+				node.refs = append(node.refs, funcRef{pkg: importPath, name: n.Name})
+			}
+			return true
+		}
+		ast.Inspect(fd.Body, visit)
+	}
+}
+
+// recvName returns the name of the type of a method receiver
+func recvName(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case *ast.StarExpr:
+		return recvName(e.X)
+	case *ast.IndexExpr:
+		return recvName(e.X)
+	case *ast.IndexListExpr:
+		return recvName(e.X)
+	case *ast.Ident:
+		return e.Name
+	}
+	return ""
+}
+
+// reach returns the number of statements in the funcs reachable from the func at key,
+// including the func itself
+func (g *codeGraph) reach(key string) int {
+	seen := map[string]bool{key: true}
+	queue := []string{key}
+	total := 0
+	for len(queue) > 0 {
+		node := g.funcs[queue[0]]
+		queue = queue[1:]
+		if node == nil {
+			continue
+		}
+		total += node.stmts
+		for _, ref := range node.refs {
+			keys := g.methods[ref.name]
+			if ref.pkg != "" {
+				keys = []string{ref.pkg + "." + ref.name}
+			}
+			for _, k := range keys {
+				if !seen[k] && g.funcs[k] != nil {
+					seen[k] = true
+					queue = append(queue, k)
+				}
+			}
+		}
+	}
+	return total
+}
+
+// weighTargets sets the reach of the targets, which is the amount of code reachable from their fuzz functions,
+// and orders them by it, so that the targets that can find the most are run first
+func weighTargets(targets []fuzz, g *codeGraph) []fuzz {
+	weighed := make([]fuzz, len(targets))
+	for i, f := range targets {
+		importPath, err := importPathOf(f.pkg)
+		if err == nil {
+			f.reach = g.reach(importPath + "." + f.fn)
+		}
+		logger.Debug("weighed target", "target", f.fullpath, "reach", f.reach)
+		weighed[i] = f
+	}
+	byReach(weighed)
+	return weighed
+}
+
+// byReach sorts targets by their reach, from the highest,
+// keeping the order of the targets of the same reach
+func byReach(targets []fuzz) {
+	sort.SliceStable(targets, func(i, j int) bool {
+		return targets[i].reach > targets[j].reach
+	})
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const replayRunHelpText = `Usage: gofuzz replay-run [OPTIONS...] RUN
+
+replay-run repeats a run recorded in the stats DB specified by -stats-dir,
+as closely as possible: gofuzz is started in the same dir with the same args,
+and the targets are run in the order the run started them, with the args
+that it gave them, such as the -fuzztime decided by a plugin.
+targets are not selected again, so -sample, -rotate, -rerun-failures
+and plugins have no effect on the replay.
+"latest" and "previous" can be used in place of the last two run ids.
+
+Options:
+`
+
+// scheduleExt is the extension of the schedule files of runs in the stats DB
+const scheduleExt = ".schedule.json"
+
+// runSchedule is what a run did and in what order, which is enough to repeat it
+type runSchedule struct {
+	Run string `json:"run"`
+	// Dir is the working dir that gofuzz was started in
+	Dir string `json:"dir"`
+	// Args are the args that gofuzz was started with
+	Args    []string          `json:"args"`
+	Targets []scheduledTarget `json:"targets"`
+}
+
+// scheduledTarget is a target that a run started
+type scheduledTarget struct {
+	Target string `json:"target"`
+	// Args are the extra go test args that the target was run with
+	Args []string `json:"args,omitempty"`
+}
+
+// scheduleRecorder records the targets of a run, by the order they were taken up in
+type scheduleRecorder struct {
+	mu      sync.Mutex
+	targets map[int]scheduledTarget
+}
+
+// add records the target that was taken up seq-th, and the extra args it was run with
+func (r *scheduleRecorder) add(seq int, target string, args []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.targets == nil {
+		r.targets = make(map[int]scheduledTarget)
+	}
+	r.targets[seq] = scheduledTarget{Target: target, Args: args}
+}
+
+// save writes the schedule of the run to the stats DB
+func (r *scheduleRecorder) save(db statsDB, sched runSchedule) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	seqs := make([]int, 0, len(r.targets))
+	for seq := range r.targets {
+		seqs = append(seqs, seq)
+	}
+	sort.Ints(seqs)
+	for _, seq := range seqs {
+		sched.Targets = append(sched.Targets, r.targets[seq])
+	}
+	data, err := json.MarshalIndent(sched, "", "  ")
+	if err != nil {
+		return err
+	}
+	p := filepath.Join(db.dir, sched.Run+scheduleExt)
+	err = os.WriteFile(p, data, 0o644)
+	if err != nil {
+		return fmt.Errorf(`could not write schedule "%s": %w`, p, err)
+	}
+	return nil
+}
+
+// readSchedule reads the schedule file at p, which must have targets
+func readSchedule(p string) (*runSchedule, error) {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, fmt.Errorf(`could not read schedule "%s": %w`, p, err)
+	}
+	var sched runSchedule
+	err = json.Unmarshal(data, &sched)
+	if err != nil {
+		return nil, fmt.Errorf(`invalid schedule "%s": %w`, p, err)
+	}
+	// replaying a run that started no targets would pass without testing anything
+	if len(sched.Targets) == 0 {
+		return nil, fmt.Errorf(`schedule "%s" has no targets to replay`, p)
+	}
+	return &sched, nil
+}
+
+// schedulePath returns the path of the schedule file of the given run,
+// which may also be "latest" or "previous"
+func (db statsDB) schedulePath(run string) (string, error) {
+	if run != "latest" && run != "previous" {
+		return filepath.Join(db.dir, run+scheduleExt), nil
+	}
+	entries, err := os.ReadDir(db.dir)
+	if err != nil {
+		return "", fmt.Errorf(`could not read stats dir "%s": %w`, db.dir, err)
+	}
+	// run ids begin with their start time, so their order is chronological
+	var runs []string
+	for _, entry := range entries {
+		if name, ok := strings.CutSuffix(entry.Name(), scheduleExt); ok {
+			runs = append(runs, name)
+		}
+	}
+	sort.Strings(runs)
+	n := 1
+	if run == "previous" {
+		n = 2
+	}
+	if len(runs) < n {
+		return "", fmt.Errorf("the stats DB contains fewer than %d recorded schedules", n)
+	}
+	return filepath.Join(db.dir, runs[len(runs)-n]+scheduleExt), nil
+}
+
+// ordered returns the targets of the schedule among targets, in the order of the schedule.
+// scheduled targets that no longer exist are reported and left out.
+func (s *runSchedule) ordered(targets []fuzz) []fuzz {
+	byPath := make(map[string]fuzz, len(targets))
+	for _, f := range targets {
+		byPath[f.fullpath] = f
+	}
+	out := make([]fuzz, 0, len(s.Targets))
+	for _, t := range s.Targets {
+		f, ok := byPath[t.Target]
+		if !ok {
+			logger.Warn("not replaying target, as it no longer exists", "target", t.Target)
+			continue
+		}
+		out = append(out, f)
+	}
+	return out
+}
+
+// args returns the extra args that the target was run with
+func (s *runSchedule) args(target string) []string {
+	for _, t := range s.Targets {
+		if t.Target == target {
+			return t.Args
+		}
+	}
+	return nil
+}
+
+// replayRunArgs implements the replay-run subcommand.
+// it changes to the dir of the run and returns the args to run gofuzz with.
+func replayRunArgs(args []string) []string {
+	flags := flag.NewFlagSet("replay-run", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, replayRunHelpText)
+		flags.PrintDefaults()
+	}
+	statsDir := flags.String("stats-dir", "", "stats DB to read the run from")
+	flags.Parse(args)
+	if *statsDir == "" {
+		die("-stats-dir is required.")
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	p, err := statsDB{dir: *statsDir}.schedulePath(flags.Arg(0))
+	if err != nil {
+		die(err)
+	}
+	p, err = filepath.Abs(p)
+	if err != nil {
+		die(err)
+	}
+	sched, err := readSchedule(p)
+	if err != nil {
+		die(err)
+	}
+	err = os.Chdir(sched.Dir)
+	if err != nil {
+		die(fmt.Errorf(`could not change directory to "%s": %w`, sched.Dir, err))
+	}
+	logger.Info("replaying run", "run", sched.Run, "targets", len(sched.Targets))
+	return append([]string{"-replay-schedule=" + p}, sched.Args...)
+}
@@ -0,0 +1,532 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// event types
+const (
+	eventRunStart     = "run-start"
+	eventTargetStart  = "target-start"
+	eventTargetFinish = "target-finish"
+	eventFinding      = "finding"
+	eventRunEnd       = "run-end"
+)
+
+// event is something that happened during a run.
+// events are passed to reporters, and are what the json and exec reporters emit.
+type event struct {
+	Type   string    `json:"type"`
+	Time   time.Time `json:"time"`
+	Run    string    `json:"run"`
+	Target string    `json:"target,omitempty"`
+	Pkg    string    `json:"pkg,omitempty"`
+	Func   string    `json:"func,omitempty"`
+	Owners []string  `json:"owners,omitempty"`
+	// Quarantined is set if the target is quarantined, so its failures don't fail the run
+	Quarantined bool   `json:"quarantined,omitempty"`
+	Status      string `json:"status,omitempty"`
+	// Category is the failure category of the target, if it failed, as in -fail-on
+	Category string `json:"category,omitempty"`
+	// Start and End are when the target started and finished, and Duration is
+	// the time in between as measured by the monotonic clock, in nanoseconds
+	Start    *time.Time    `json:"start,omitempty"`
+	End      *time.Time    `json:"end,omitempty"`
+	Duration time.Duration `json:"duration,omitempty"`
+	// Fuzztime is the -fuzztime that the target is run with, if any
+	Fuzztime string `json:"fuzztime,omitempty"`
+	// CPU is the cpu time that the target used, in nanoseconds
+	CPU time.Duration `json:"cpu,omitempty"`
+	// Compile is the time it took to build the test binary of the target, in nanoseconds
+	Compile time.Duration `json:"compile,omitempty"`
+	// Execs is the number of executions of the fuzz function, and ExecsPerSec is their rate
+	Execs       int64   `json:"execs,omitempty"`
+	ExecsPerSec float64 `json:"execs_per_sec,omitempty"`
+	Output      string  `json:"output,omitempty"`
+	Error       string  `json:"error,omitempty"`
+	Input       string  `json:"input,omitempty"`
+	// Withheld is set if possible secrets were withheld from the output and excerpt, as in -scan-secrets block
+	Withheld bool `json:"withheld,omitempty"`
+	// Reason is why gofuzz skipped the target without running it, such as the decision of a plugin
+	Reason string `json:"reason,omitempty"`
+	// Excerpt is what matters about the failure of the target, if it failed
+	Excerpt *failureExcerpt `json:"excerpt,omitempty"`
+	Summary *summary        `json:"summary,omitempty"`
+	// Clusters group the failed targets of the run by the function that panicked
+	Clusters []failureCluster `json:"clusters,omitempty"`
+	// NotRun are the targets that never started because the run was cancelled first
+	NotRun []string `json:"not_run,omitempty"`
+	// Seed is the -sample-seed of the run, if it samples targets
+	Seed int64 `json:"seed,omitempty"`
+	// Note and Labels are the -note and -label of the run
+	Note   string            `json:"note,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// result is the result the event is about, if any
+	result *result
+}
+
+// summary contains the counts of target results of a run
+type summary struct {
+	Total   int `json:"total"`
+	Passed  int `json:"passed"`
+	Failed  int `json:"failed"`
+	Broken  int `json:"broken"`
+	Skipped int `json:"skipped"`
+	// Cancelled counts the targets that were stopped by the cancellation of the run
+	Cancelled int `json:"cancelled"`
+	// Execs is the number of executions of every target,
+	// and ExecsPerSec is their rate over the duration of the run
+	Execs       int64   `json:"execs"`
+	ExecsPerSec float64 `json:"execs_per_sec"`
+	Success     bool    `json:"success"`
+}
+
+// add counts r in the summary
+func (s *summary) add(r result) {
+	s.Total++
+	if t, ok := r.throughput(); ok {
+		s.Execs += t.execs
+	}
+	switch r.status() {
+	case "pass":
+		s.Passed++
+	case "fail":
+		s.Failed++
+	case "broken":
+		s.Broken++
+	case "skip":
+		s.Skipped++
+	case "cancelled":
+		s.Cancelled++
+	}
+}
+
+// reporter receives the events of a run and reports them somewhere
+type reporter interface {
+	report(e event) error
+	// close is called after the last event
+	close() error
+}
+
+// reporterList passes each event to multiple reporters.
+// it is safe for concurrent use.
+type reporterList struct {
+	mu        sync.Mutex
+	run       string
+	reporters []reporter
+}
+
+// report stamps the event with the run id and the current time,
+// and passes it to every reporter
+func (l *reporterList) report(e event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e.Run = l.run
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	for _, rep := range l.reporters {
+		err := rep.report(e)
+		if err != nil {
+			logger.Warn("reporter failed", "err", err)
+		}
+	}
+}
+
+// close closes every reporter and returns the first error
+func (l *reporterList) close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var first error
+	for _, rep := range l.reporters {
+		err := rep.close()
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// resultEvent returns an event of type typ about r
+func resultEvent(typ string, r result) event {
+	e := event{
+		Type:        typ,
+		Target:      r.fullpath,
+		Pkg:         r.pkg,
+		Func:        r.fn,
+		Owners:      r.owners,
+		Quarantined: r.quarantined,
+		Status:      r.status(),
+		Category:    r.category(),
+		Duration:    r.duration,
+		CPU:         r.cpu,
+		Compile:     r.compile,
+		Output:      r.output,
+		Input:       r.input,
+		Excerpt:     r.excerpt(),
+		Reason:      r.skipReason,
+		Withheld:    r.withheld,
+		result:      &r,
+	}
+	if r.err != nil {
+		e.Error = r.err.Error()
+	}
+	if t, ok := r.throughput(); ok {
+		e.Execs, e.ExecsPerSec = t.execs, t.perSec()
+	}
+	if !r.start.IsZero() {
+		start, end := r.start.Round(0), r.end()
+		e.Start, e.End = &start, &end
+	}
+	return e
+}
+
+// fuzzEvent returns an event of type typ about f
+func fuzzEvent(typ string, f fuzz) event {
+	return event{
+		Type:   typ,
+		Target: f.fullpath,
+		Pkg:    f.pkg,
+		Func:   f.fn,
+		Owners: f.owners,
+	}
+}
+
+// newReporter creates a reporter from a spec of the form KIND[=ARG]
+func newReporter(spec string) (reporter, error) {
+	kind, arg, _ := strings.Cut(spec, "=")
+	switch kind {
+	case "console":
+		return &consoleReporter{w: os.Stdout}, nil
+	case "json":
+		w, err := openReport(arg)
+		if err != nil {
+			return nil, err
+		}
+		return &jsonReporter{w: w, enc: json.NewEncoder(w)}, nil
+	case "junit":
+		if arg == "" {
+			return nil, fmt.Errorf("the junit reporter needs a file, as in junit=FILE")
+		}
+		w, err := openReport(arg)
+		if err != nil {
+			return nil, err
+		}
+		return &junitReporter{w: w}, nil
+	case "sarif":
+		if arg == "" {
+			return nil, fmt.Errorf("the sarif reporter needs a file, as in sarif=FILE")
+		}
+		w, err := openReport(arg)
+		if err != nil {
+			return nil, err
+		}
+		return &sarifReporter{w: w}, nil
+	case "markdown":
+		if arg == "" {
+			return nil, fmt.Errorf("the markdown reporter needs a file, as in markdown=FILE")
+		}
+		w, err := openReport(arg)
+		if err != nil {
+			return nil, err
+		}
+		return &markdownReporter{w: w}, nil
+	case "tap":
+		w, err := openReport(arg)
+		if err != nil {
+			return nil, err
+		}
+		return &tapReporter{w: w}, nil
+	case "github":
+		return &githubReporter{w: os.Stdout}, nil
+	case "exec":
+		return newExecReporter(arg)
+	}
+	return nil, fmt.Errorf(`unknown reporter "%s"`, kind)
+}
+
+// nopCloser is a writer whose Close does nothing
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// openReport opens the file that a reporter writes to.
+// an empty name or "-" means stdout, and fd:N means the already open file descriptor N.
+// named pipes work too; opening one blocks until its reader opens it.
+func openReport(name string) (io.WriteCloser, error) {
+	if name == "" || name == "-" {
+		return nopCloser{os.Stdout}, nil
+	}
+	if fd, ok := strings.CutPrefix(name, "fd:"); ok {
+		n, err := strconv.Atoi(fd)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf(`invalid file descriptor "%s"`, name)
+		}
+		file := os.NewFile(uintptr(n), name)
+		_, err = file.Stat()
+		if err != nil {
+			return nil, fmt.Errorf(`file descriptor %d is not open: %w`, n, err)
+		}
+		return file, nil
+	}
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf(`could not create report "%s": %w`, name, err)
+	}
+	return file, nil
+}
+
+// consoleReporter prints human-readable results
+type consoleReporter struct {
+	w io.Writer
+	// listFailed makes the final lists include failed targets too
+	listFailed bool
+	// streamed is set if the output of targets was already printed as it arrived
+	streamed bool
+	// quiet leaves out the targets that didn't fail or break, and adds a summary
+	quiet bool
+	// color colors the headers by the status of the targets, and highlights panics
+	color bool
+	// broken, failed, skipped and cancelled contain the paths of targets
+	// that failed their pre-check, that failed fuzzing,
+	// that skipped instead of fuzzing, and that were stopped by the cancellation of the run,
+	// respectively
+	broken, failed, skipped, cancelled []string
+	// throughputs are those of the fuzzed targets, and runStart is when the run started
+	throughputs []targetThroughput
+	runStart    time.Time
+	// table makes a summary table of the targets be printed at the end, with rows of their results
+	table bool
+	rows  []tableRow
+	// format is the format of the summary table: text, csv or markdown
+	format string
+	// top is the number of slowest targets and packages to print at the end,
+	// and timings are the wall and compile times of the targets
+	top     int
+	timings []targetTiming
+	// fair makes a fairness report be printed at the end, of the targets started and finished so far
+	fair     bool
+	started  map[string]event
+	fairness []fairnessEntry
+}
+
+func (c *consoleReporter) report(e event) error {
+	switch e.Type {
+	case eventRunStart:
+		c.runStart = e.Time
+	case eventTargetStart:
+		if c.fair {
+			c.trackStart(e)
+		}
+	case eventTargetFinish:
+		r := e.result
+		if c.fair {
+			c.trackFinish(e)
+		}
+		if t, ok := r.throughput(); ok {
+			c.throughputs = append(c.throughputs, targetThroughput{path: r.fullpath, throughput: t})
+		}
+		if c.table {
+			c.rows = append(c.rows, newTableRow(*r))
+		}
+		if c.top > 0 {
+			c.timings = append(c.timings, targetTiming{path: r.fullpath, pkg: r.pkg, wall: r.duration, compile: r.compile})
+		}
+		switch r.status() {
+		case "broken":
+			c.broken = append(c.broken, r.fullpath)
+		case "fail":
+			c.failed = append(c.failed, r.fullpath)
+		case "skip":
+			c.skipped = append(c.skipped, r.fullpath)
+		case "cancelled":
+			c.cancelled = append(c.cancelled, r.fullpath)
+		}
+		if c.quiet && r.status() != "fail" && r.status() != "broken" {
+			return nil
+		}
+		header := fmt.Sprintf("===== %s/%s =====", r.pkg, r.fn)
+		if c.streamed {
+			header = fmt.Sprintf("===== %s/%s: %s =====", r.pkg, r.fn, r.status())
+		}
+		output := r.output
+		if c.color {
+			header = paint(header, colorBold, statusColor(r.status()))
+			output = highlightPanics(output)
+		}
+		fmt.Fprintln(c.w, header)
+		if r.withheld {
+			fmt.Fprintln(c.w, "(possible secrets were withheld from the output)")
+		}
+		if !c.streamed {
+			fmt.Fprintln(c.w, output)
+		}
+		if r.err != nil && !strings.Contains(r.err.Error(), "exit status") {
+			fmt.Fprintln(c.w, r.err)
+			fmt.Fprintln(c.w)
+		}
+	case eventRunEnd:
+		// list broken targets separately from genuine fuzzing failures,
+		// and skipped targets separately from passing ones
+		c.printList("broken targets (build or pre-check failed)", colorRed, c.broken)
+		if c.listFailed {
+			c.printList("failed targets", colorRed, c.failed)
+		}
+		c.printList("not fuzzed (skipped)", colorYellow, c.skipped)
+		c.printList("cancelled", colorYellow, c.cancelled)
+		c.printList("not run", colorYellow, e.NotRun)
+		c.printClusters(e.Clusters)
+		c.printSlowest()
+		if c.fair {
+			c.printFairness()
+		}
+		c.printThroughput(e.Time.Sub(c.runStart))
+		if e.Status == "cancelled" {
+			fmt.Fprintf(c.w, "run cancelled (%s); results are partial\n\n", e.Error)
+		}
+		if c.table {
+			c.printTable(e.Summary)
+		} else if s := e.Summary; c.quiet && s != nil {
+			fmt.Fprintf(c.w, "%d targets: %d passed, %d failed, %d broken, %d skipped, %d cancelled\n",
+				s.Total, s.Passed, s.Failed, s.Broken, s.Skipped, s.Cancelled)
+		}
+	}
+	return nil
+}
+
+// printList prints a titled list of target paths, if it's not empty.
+// the title is in the given color, if the output is colored.
+func (c *consoleReporter) printList(title string, color string, paths []string) {
+	if len(paths) == 0 {
+		return
+	}
+	header := fmt.Sprintf("===== %s =====", title)
+	if c.color {
+		header = paint(header, colorBold, color)
+	}
+	fmt.Fprintln(c.w, header)
+	for _, p := range paths {
+		fmt.Fprintln(c.w, p)
+	}
+	fmt.Fprintln(c.w)
+}
+
+// printClusters prints the failure clusters, so that a bug that many targets hit shows up once
+func (c *consoleReporter) printClusters(clusters []failureCluster) {
+	if len(clusters) == 0 {
+		return
+	}
+	header := "===== failures by crash site ====="
+	if c.color {
+		header = paint(header, colorBold, colorRed)
+	}
+	fmt.Fprintln(c.w, header)
+	for _, cluster := range clusters {
+		fmt.Fprintf(c.w, "%s: %s\n", cluster.Frame, cluster.hits())
+		for _, t := range cluster.Targets {
+			fmt.Fprintln(c.w, "    "+t)
+		}
+	}
+	fmt.Fprintln(c.w)
+}
+
+func (c *consoleReporter) close() error {
+	return nil
+}
+
+// jsonReporter writes events as newline-delimited json
+type jsonReporter struct {
+	w   io.WriteCloser
+	enc *json.Encoder
+	// broken is set once the reader of the pipe that the reporter writes to has gone away,
+	// so that losing an events consumer neither aborts the run nor produces an error per event
+	broken bool
+}
+
+func (j *jsonReporter) report(e event) error {
+	if j.broken {
+		return nil
+	}
+	err := j.enc.Encode(e)
+	if errors.Is(err, syscall.EPIPE) {
+		j.broken = true
+		return fmt.Errorf("the reader of the events went away, so no more are written: %w", err)
+	}
+	return err
+}
+
+func (j *jsonReporter) close() error {
+	return j.w.Close()
+}
+
+// execReporter writes events as newline-delimited json
+// to the stdin of an external command
+type execReporter struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	enc   *json.Encoder
+	// broken is set once writing to the command has failed,
+	// so that a dead reporter doesn't produce an error per event
+	broken bool
+}
+
+// newExecReporter starts the given command, which is split with splitCommand
+func newExecReporter(command string) (*execReporter, error) {
+	args, err := splitCommand(command)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("the exec reporter needs a command, as in exec=CMD")
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	err = cmd.Start()
+	if err != nil {
+		return nil, fmt.Errorf(`could not start reporter "%s": %w`, command, err)
+	}
+	return &execReporter{cmd: cmd, stdin: stdin, enc: json.NewEncoder(stdin)}, nil
+}
+
+func (x *execReporter) report(e event) error {
+	if x.broken {
+		return nil
+	}
+	err := x.enc.Encode(e)
+	if err != nil {
+		x.broken = true
+		return fmt.Errorf(`could not write to reporter "%s": %w`, x.cmd.Path, err)
+	}
+	return nil
+}
+
+func (x *execReporter) close() error {
+	x.stdin.Close()
+	err := x.cmd.Wait()
+	// a reporter that went away was already reported when writing to it failed,
+	// and doesn't fail the run
+	if err != nil && !x.broken {
+		return fmt.Errorf(`reporter "%s" failed: %w`, x.cmd.Path, err)
+	}
+	return nil
+}
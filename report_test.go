@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// a reporter that exits before reading the events must not fail the run
+func TestExecReporterExitsEarly(t *testing.T) {
+	x, err := newExecReporter("true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for !x.broken && time.Now().Before(deadline) {
+		err := x.report(event{Type: eventTargetFinish, Target: "a/FuzzA", Output: string(make([]byte, 4096))})
+		if err != nil {
+			t.Log(err)
+		}
+	}
+	if !x.broken {
+		t.Fatal("writing to a reporter that exited didn't fail")
+	}
+	err = x.report(event{Type: eventTargetFinish, Target: "a/FuzzB"})
+	if err != nil {
+		t.Errorf("a broken reporter reported an error again: %v", err)
+	}
+	err = x.close()
+	if err != nil {
+		t.Errorf("a reporter that exited early failed the run: %v", err)
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+const reproHelpText = `Usage: gofuzz repro [OPTIONS...] INPUT
+       gofuzz repro [OPTIONS...] TARGET [ENTRY]
+
+repro runs a failing input of a target again, to reproduce the failure.
+INPUT is the path of the input in the seed corpus, such as
+path/to/package/testdata/fuzz/FuzzFuncName/ENTRY, as reports show it.
+otherwise, TARGET is path/to/package/FuzzFuncName, and ENTRY is the name of
+the entry in its seed corpus dir, which is the newest entry if not given.
+
+with -debug, the input is run under delve, which stops at the panic site
+of the failure, so that it can be examined right away.
+with -debugger rr, which only works on linux, the run is recorded with rr
+first and the recording is replayed under delve, so that the execution
+that led to the panic can be stepped backwards through too.
+failures that don't panic, such as those of t.Error, aren't stopped at;
+set a breakpoint at them instead.
+
+Options:
+`
+
+// reproCmd implements the repro subcommand
+func reproCmd(args []string) {
+	flags := flag.NewFlagSet("repro", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, reproHelpText)
+		flags.PrintDefaults()
+	}
+	root := flags.String("root", ".", "root dir of the go project")
+	debug := flags.Bool("debug", false, "run the input under a debugger that stops at the panic site")
+	debugger := flags.String("debugger", "dlv", "debugger of -debug: dlv, or rr to record the run and replay it under delve")
+	flags.Parse(args)
+	if flags.NArg() < 1 || flags.NArg() > 2 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	switch *debugger {
+	case "dlv":
+	case "rr":
+		if runtime.GOOS != "linux" {
+			die("-debugger rr only works on linux.")
+		}
+	default:
+		die(fmt.Sprintf(`invalid -debugger value "%s".`, *debugger))
+	}
+	err := os.Chdir(*root)
+	if err != nil {
+		die(fmt.Errorf(`could not change directory to "%s": %w`, *root, err))
+	}
+	f, entry, err := reproInput(flags.Args())
+	if err != nil {
+		die(err)
+	}
+	pattern := fmt.Sprintf("^%s$/^%s$", f.fn, regexp.QuoteMeta(entry))
+	fmt.Fprintf(os.Stderr, "reproducing %s with %s\n", f.fullpath, path.Join(f.pkg, "testdata", "fuzz", f.fn, entry))
+
+	var cmd *exec.Cmd
+	switch {
+	case !*debug:
+		cmd = exec.Command("go", "test", "./"+f.pkg, "-run="+pattern, "-v")
+	case *debugger == "dlv":
+		init, err := debuggerInit()
+		if err != nil {
+			die(err)
+		}
+		cmd = exec.Command("dlv", "test", "./"+f.pkg, "--init="+init, "--", "-test.run="+pattern, "-test.v")
+	case *debugger == "rr":
+		trace, err := recordRepro(f, pattern)
+		if err != nil {
+			die(err)
+		}
+		init, err := debuggerInit()
+		if err != nil {
+			die(err)
+		}
+		cmd = exec.Command("dlv", "replay", trace, "--init="+init)
+	}
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	err = cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		finalizers.run()
+		os.Exit(exitErr.ExitCode())
+	}
+	if err != nil {
+		die(fmt.Errorf(`could not run "%s": %w`, strings.Join(cmd.Args, " "), err))
+	}
+	finalizers.run()
+}
+
+// reproInput returns the target and the seed corpus entry that the args of repro refer to
+func reproInput(args []string) (fuzz, string, error) {
+	arg := strings.TrimPrefix(path.Clean(filepath.ToSlash(args[0])), "./")
+	var pkg, fn, entry string
+	if before, after, ok := strings.Cut(arg, "/testdata/fuzz/"); ok && len(args) == 1 {
+		pkg = before
+		fn, entry, _ = strings.Cut(after, "/")
+	} else if strings.HasPrefix(arg, "testdata/fuzz/") && len(args) == 1 {
+		pkg = "."
+		fn, entry, _ = strings.Cut(strings.TrimPrefix(arg, "testdata/fuzz/"), "/")
+	} else {
+		pkg, fn = path.Split(arg)
+		pkg = path.Clean(pkg)
+		if len(args) == 2 {
+			entry = args[1]
+		}
+	}
+	if !fuzzRgx.MatchString("func " + fn) {
+		return fuzz{}, "", fmt.Errorf(`invalid target "%s": expected path/to/package/FuzzFuncName`, args[0])
+	}
+	f := fuzz{fn: fn, pkg: pkg, fullpath: pkg + "/" + fn}
+	if entry == "" {
+		newest, err := newestEntry(seedDir(f))
+		if err != nil {
+			return fuzz{}, "", err
+		}
+		entry = newest
+	}
+	_, err := os.Stat(filepath.Join(seedDir(f), filepath.FromSlash(entry)))
+	if err != nil {
+		return fuzz{}, "", fmt.Errorf(`could not find the input "%s" of %s: %w`, entry, f.fullpath, err)
+	}
+	return f, entry, nil
+}
+
+// newestEntry returns the name of the most recently modified entry of the seed corpus dir at dir
+func newestEntry(dir string) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", fmt.Errorf(`could not read seed corpus dir "%s": %w`, dir, err)
+	}
+	newest := ""
+	var newestInfo os.FileInfo
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if newestInfo == nil || info.ModTime().After(newestInfo.ModTime()) {
+			newest, newestInfo = entry.Name(), info
+		}
+	}
+	if newest == "" {
+		return "", fmt.Errorf(`seed corpus dir "%s" has no entries`, dir)
+	}
+	return newest, nil
+}
+
+// debuggerInit writes the init file of delve, which continues to the panic,
+// where delve stops by itself, and returns its path
+func debuggerInit() (string, error) {
+	file, err := os.CreateTemp("", "gofuzz-repro-*.dlv")
+	if err != nil {
+		return "", fmt.Errorf("could not create the delve init file: %w", err)
+	}
+	finalizers.add(func() { os.Remove(file.Name()) })
+	_, err = file.WriteString("continue\n")
+	if err == nil {
+		err = file.Close()
+	}
+	if err != nil {
+		return "", fmt.Errorf(`could not write the delve init file "%s": %w`, file.Name(), err)
+	}
+	return file.Name(), nil
+}
+
+// recordRepro builds the test binary of f without optimizations, records it running
+// the input that the -run pattern selects with rr, and returns the dir of the recording
+func recordRepro(f fuzz, pattern string) (string, error) {
+	dir, err := os.MkdirTemp("", "gofuzz-repro-*")
+	if err != nil {
+		return "", fmt.Errorf("could not create the recording dir: %w", err)
+	}
+	finalizers.add(func() { os.RemoveAll(dir) })
+	bin := filepath.Join(dir, f.fn+".test")
+	build := exec.Command("go", "test", "-c", "-gcflags=all=-N -l", "-o", bin, "./"+f.pkg)
+	build.Stdout, build.Stderr = os.Stderr, os.Stderr
+	err = build.Run()
+	if err != nil {
+		return "", fmt.Errorf("could not build the test binary of %s: %w", f.fullpath, err)
+	}
+	trace := filepath.Join(dir, "trace")
+	// tests run in the dir of their package, as they do with go test
+	record := exec.Command("rr", "record", "--output-trace-dir="+trace, bin, "-test.run="+pattern, "-test.v")
+	record.Dir = filepath.FromSlash(f.pkg)
+	record.Stdout, record.Stderr = os.Stdout, os.Stderr
+	err = record.Run()
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return "", fmt.Errorf("could not record %s with rr: %w", f.fullpath, err)
+	}
+	if exitErr == nil {
+		fmt.Fprintf(os.Stderr, "%s passed with the input; replaying the recording anyway\n", f.fullpath)
+	}
+	return trace, nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// rerunStatuses are the statuses of targets that rerun-failures runs again
+var rerunStatuses = map[string]bool{
+	"fail": true,
+}
+
+// failuresFromReport returns the targets that failed in a json report,
+// as written by -reporter json=FILE
+func failuresFromReport(p string) (map[string]bool, error) {
+	file, err := os.Open(p)
+	if err != nil {
+		return nil, fmt.Errorf(`could not open report "%s": %w`, p, err)
+	}
+	defer file.Close()
+	failed := make(map[string]bool)
+	sc := bufio.NewScanner(file)
+	sc.Buffer(nil, 64*1024*1024)
+	for sc.Scan() {
+		var e event
+		err := json.Unmarshal(sc.Bytes(), &e)
+		if err != nil {
+			return nil, fmt.Errorf(`invalid event in report "%s": %w`, p, err)
+		}
+		if e.Type == eventTargetFinish && rerunStatuses[e.Status] {
+			failed[e.Target] = true
+		}
+	}
+	err = sc.Err()
+	if err != nil {
+		return nil, fmt.Errorf(`could not scan report "%s": %w`, p, err)
+	}
+	return failed, nil
+}
+
+// failuresFromStats returns the targets that failed in the latest run in db
+func failuresFromStats(db statsDB) (map[string]bool, error) {
+	recs, err := db.records()
+	if err != nil {
+		return nil, err
+	}
+	if len(recs) == 0 {
+		return nil, errors.New("the stats DB contains no runs")
+	}
+	// records are ordered by start time
+	last := recs[len(recs)-1].Run
+	failed := make(map[string]bool)
+	for _, rec := range recs {
+		if rec.Run == last && rerunStatuses[rec.Status] {
+			failed[rec.Target] = true
+		}
+	}
+	return failed, nil
+}
+
+// filterTargets returns the targets whose path is in keep
+func filterTargets(targets []fuzz, keep map[string]bool) []fuzz {
+	var out []fuzz
+	for _, f := range targets {
+		if keep[f.fullpath] {
+			out = append(out, f)
+		}
+	}
+	return out
+}
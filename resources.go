@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// resourcePollInterval is how often the resource usage of gofuzz and its descendants is sampled
+const resourcePollInterval = time.Second
+
+// resourceLimits caps the resources used by gofuzz and the targets it runs.
+// they are enforced by holding back new targets, not by stopping running ones.
+type resourceLimits struct {
+	// cpu is the number of cpus' worth of cpu time used per second, or zero for no limit
+	cpu float64
+	// mem is the memory used, in bytes, or zero for no limit
+	mem int64
+}
+
+// resourceMonitor samples the resource usage of gofuzz and its descendants
+type resourceMonitor struct {
+	limits resourceLimits
+	mu     sync.Mutex
+	// cpu is the number of cpus used in the last interval, and mem the memory used
+	cpu float64
+	mem int64
+	// samples counts the samples taken, and admitted is what it was when the last target was let through,
+	// so that every target is let through on a sample taken after the one before it started.
+	// sampled is closed and replaced whenever a sample is taken.
+	samples  int
+	admitted int
+	sampled  chan struct{}
+}
+
+// resourceBaselineInterval is how long the first sample of the cpu usage is measured over
+const resourceBaselineInterval = 100 * time.Millisecond
+
+// newResourceMonitor takes a first sample of the resource usage,
+// and keeps sampling it until ctx is done
+func newResourceMonitor(ctx context.Context, limits resourceLimits) (*resourceMonitor, error) {
+	pid := os.Getpid()
+	last, _, err := treeUsage(pid)
+	if err != nil {
+		return nil, err
+	}
+	lastTime := time.Now()
+	time.Sleep(resourceBaselineInterval)
+	m := &resourceMonitor{limits: limits, sampled: make(chan struct{})}
+	// a failed sample keeps the previous usage, rather than holding back targets until one succeeds
+	sample := func() {
+		cpu, mem, err := treeUsage(pid)
+		now := time.Now()
+		m.mu.Lock()
+		if err == nil {
+			m.cpu = float64(cpu-last) / float64(now.Sub(lastTime))
+			m.mem = mem
+			last, lastTime = cpu, now
+		} else {
+			logger.Debug("could not sample the resource usage", "err", err)
+		}
+		m.samples++
+		close(m.sampled)
+		m.sampled = make(chan struct{})
+		m.mu.Unlock()
+	}
+	sample()
+	go func() {
+		ticker := time.NewTicker(resourcePollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				sample()
+			}
+		}
+	}()
+	return m, nil
+}
+
+// exceeded returns which limit the last sample is at or above, if any.
+// m.mu must be held.
+func (m *resourceMonitor) exceeded() string {
+	switch {
+	case m.limits.cpu > 0 && m.cpu >= m.limits.cpu:
+		return fmt.Sprintf("using %.1f cpus, at least -max-total-cpu of %g", m.cpu, m.limits.cpu)
+	case m.limits.mem > 0 && m.mem >= m.limits.mem:
+		return fmt.Sprintf("using %d bytes of memory, at least -max-total-mem of %d", m.mem, m.limits.mem)
+	}
+	return ""
+}
+
+// wait blocks while gofuzz and its descendants use as much as the limits allow,
+// or until ctx is done.
+// it also waits for a sample taken after the previous target was let through,
+// so that targets started together can't all get past the limits before any of them is measured.
+func (m *resourceMonitor) wait(ctx context.Context) {
+	held := false
+	for {
+		m.mu.Lock()
+		reason := m.exceeded()
+		if m.samples > m.admitted && reason == "" {
+			m.admitted = m.samples
+			m.mu.Unlock()
+			if held {
+				logger.Info("starting further targets")
+			}
+			return
+		}
+		sampled := m.sampled
+		m.mu.Unlock()
+		if reason != "" && !held {
+			logger.Info("holding back further targets", "reason", reason)
+			held = true
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-sampled:
+		}
+	}
+}
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const genRoundTripHelpText = `Usage: gofuzz gen-roundtrip [OPTIONS...] DIR
+
+gen-roundtrip writes a round-trip fuzz target for every encode/decode pair
+found in the package in DIR, which is relative to the go project root.
+the pairs are functions named MarshalX and UnmarshalX, EncodeX and DecodeX,
+or FormatX and ParseX, that encode a value to a []byte or string and decode it back,
+and types with MarshalBinary, MarshalText or MarshalJSON methods
+and the matching Unmarshal methods.
+each target decodes its input, encodes the value, decodes the encoding,
+and fails if the value changed along the way.
+the targets are written to DIR, in the external test package.
+
+Options:
+`
+
+// roundTripFuncs are the prefixes of encode and decode function pairs
+var roundTripFuncs = [][2]string{
+	{"Marshal", "Unmarshal"},
+	{"Encode", "Decode"},
+	{"Format", "Parse"},
+}
+
+// roundTripMethods are the suffixes of encode and decode method pairs,
+// as in MarshalBinary and UnmarshalBinary
+var roundTripMethods = []string{"Binary", "Text", "JSON"}
+
+// roundTrip is an encode/decode pair
+type roundTrip struct {
+	// name is the name of the fuzz target
+	name string
+	typ  types.Type
+	// encoded and data are the types that are encoded to and decoded from
+	encoded, data types.Type
+	// enc and dec are the names of the encode and decode functions,
+	// or of the methods of typ if method is set
+	enc, dec string
+	method   bool
+	// encErr and decErr are set if encoding and decoding return an error
+	encErr, decErr bool
+	// decPtr is set if decoding takes a pointer to the value
+	// as its second argument, and returns only an error
+	decPtr bool
+}
+
+var errorType = types.Universe.Lookup("error").Type()
+
+// isEncoded reports whether t is a []byte or a string
+func isEncoded(t types.Type) bool {
+	return types.Identical(t, types.Typ[types.String]) ||
+		types.Identical(t, types.NewSlice(types.Typ[types.Byte]))
+}
+
+// results returns the results of sig, and whether the last one is an error
+func results(sig *types.Signature) ([]types.Type, bool) {
+	var out []types.Type
+	for i := range sig.Results().Len() {
+		out = append(out, sig.Results().At(i).Type())
+	}
+	if len(out) > 0 && types.Identical(out[len(out)-1], errorType) {
+		return out[:len(out)-1], true
+	}
+	return out, false
+}
+
+// funcRoundTrip returns the round trip of the given encode and decode functions, if they form one
+func funcRoundTrip(name string, enc, dec *types.Func) (roundTrip, bool) {
+	encSig, decSig := enc.Type().(*types.Signature), dec.Type().(*types.Signature)
+	encRes, encErr := results(encSig)
+	if encSig.Params().Len() != 1 || len(encRes) != 1 || !isEncoded(encRes[0]) {
+		return roundTrip{}, false
+	}
+	rt := roundTrip{
+		name:    name,
+		typ:     encSig.Params().At(0).Type(),
+		encoded: encRes[0],
+		enc:     enc.Name(),
+		dec:     dec.Name(),
+		encErr:  encErr,
+	}
+	decRes, decErr := results(decSig)
+	rt.decErr = decErr
+	switch {
+	case decSig.Params().Len() == 1 && len(decRes) == 1 && types.Identical(decRes[0], rt.typ):
+	case decSig.Params().Len() == 2 && len(decRes) == 0 && decErr &&
+		types.Identical(decSig.Params().At(1).Type(), types.NewPointer(rt.typ)):
+		rt.decPtr = true
+	default:
+		return roundTrip{}, false
+	}
+	rt.data = decSig.Params().At(0).Type()
+	return rt, isEncoded(rt.data)
+}
+
+// methodRoundTrip returns the round trip of the MarshalX and UnmarshalX methods
+// of the named type t, if it has them
+func methodRoundTrip(t *types.Named, suffix string) (roundTrip, bool) {
+	bytes := types.NewSlice(types.Typ[types.Byte])
+	encObj, _, _ := types.LookupFieldOrMethod(t, true, t.Obj().Pkg(), "Marshal"+suffix)
+	decObj, _, _ := types.LookupFieldOrMethod(t, true, t.Obj().Pkg(), "Unmarshal"+suffix)
+	enc, ok1 := encObj.(*types.Func)
+	dec, ok2 := decObj.(*types.Func)
+	if !ok1 || !ok2 {
+		return roundTrip{}, false
+	}
+	encSig, decSig := enc.Type().(*types.Signature), dec.Type().(*types.Signature)
+	encRes, encErr := results(encSig)
+	decRes, decErr := results(decSig)
+	if encSig.Params().Len() != 0 || len(encRes) != 1 || !types.Identical(encRes[0], bytes) {
+		return roundTrip{}, false
+	}
+	if decSig.Params().Len() != 1 || !types.Identical(decSig.Params().At(0).Type(), bytes) || len(decRes) != 0 {
+		return roundTrip{}, false
+	}
+	return roundTrip{
+		name:    "FuzzRoundTrip" + t.Obj().Name() + suffix,
+		typ:     t,
+		encoded: bytes,
+		data:    bytes,
+		enc:     enc.Name(),
+		dec:     dec.Name(),
+		method:  true,
+		encErr:  encErr,
+		decErr:  decErr,
+	}, true
+}
+
+// findRoundTrips type-checks the package in dir, whose import path is importPath,
+// and returns its round trips
+func findRoundTrips(dir, importPath string) (*types.Package, []roundTrip, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	bpkg, err := build.ImportDir(abs, 0)
+	if err != nil {
+		return nil, nil, fmt.Errorf(`could not load package "%s": %w`, dir, err)
+	}
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, name := range bpkg.GoFiles {
+		p := filepath.Join(dir, name)
+		file, err := parser.ParseFile(fset, p, nil, 0)
+		if err != nil {
+			return nil, nil, fmt.Errorf(`could not parse "%s": %w`, p, err)
+		}
+		files = append(files, file)
+	}
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	pkg, err := conf.Check(importPath, fset, files, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf(`could not type-check package "%s": %w`, dir, err)
+	}
+
+	var trips []roundTrip
+	scope := pkg.Scope()
+	names := scope.Names()
+	sort.Strings(names)
+	for _, name := range names {
+		obj := scope.Lookup(name)
+		if !obj.Exported() {
+			continue
+		}
+		if enc, ok := obj.(*types.Func); ok {
+			for _, pair := range roundTripFuncs {
+				suffix, ok := strings.CutPrefix(name, pair[0])
+				if !ok {
+					continue
+				}
+				dec, ok := scope.Lookup(pair[1] + suffix).(*types.Func)
+				if !ok {
+					continue
+				}
+				if rt, ok := funcRoundTrip("FuzzRoundTrip"+suffix, enc, dec); ok {
+					trips = append(trips, rt)
+				}
+			}
+		}
+		if tn, ok := obj.(*types.TypeName); ok && !tn.IsAlias() {
+			named, ok := tn.Type().(*types.Named)
+			if !ok || named.TypeParams() != nil {
+				continue
+			}
+			for _, suffix := range roundTripMethods {
+				if rt, ok := methodRoundTrip(named, suffix); ok {
+					trips = append(trips, rt)
+				}
+			}
+		}
+	}
+	return pkg, trips, nil
+}
+
+// isStdImport reports whether the import path p is of the standard library
+func isStdImport(p string) bool {
+	first, _, _ := strings.Cut(p, "/")
+	return !strings.Contains(first, ".")
+}
+
+// roundTripTarget returns the source of the fuzz target of rt,
+// in the external test package of pkg
+func roundTripTarget(pkg *types.Package, rt roundTrip) string {
+	imports := map[string]string{"reflect": "reflect", "testing": "testing"}
+	qualifier := func(p *types.Package) string {
+		imports[p.Path()] = p.Name()
+		return p.Name()
+	}
+	typ := types.TypeString(rt.typ, qualifier)
+	// []byte would be printed as []uint8
+	data := "string"
+	if !types.Identical(rt.data, types.Typ[types.String]) {
+		data = "[]byte"
+	}
+	pkgName := qualifier(pkg)
+
+	var body strings.Builder
+	// convert returns the code that converts the encoding in v to the decoded type
+	convert := func(v string, from types.Type) string {
+		if types.Identical(from, rt.data) {
+			return v
+		}
+		return data + "(" + v + ")"
+	}
+	declared := false
+	assign := func() string {
+		if declared {
+			return "="
+		}
+		declared = true
+		return ":="
+	}
+	decode := func(v, in, onErr string) {
+		switch {
+		case rt.method:
+			fmt.Fprintf(&body, "var %s %s\n", v, typ)
+			fmt.Fprintf(&body, "err %s %s.%s(%s)\n", assign(), v, rt.dec, in)
+		case rt.decPtr:
+			fmt.Fprintf(&body, "var %s %s\n", v, typ)
+			fmt.Fprintf(&body, "err %s %s.%s(%s, &%s)\n", assign(), pkgName, rt.dec, in, v)
+		case rt.decErr:
+			fmt.Fprintf(&body, "%s, err := %s.%s(%s)\n", v, pkgName, rt.dec, in)
+			declared = true
+		default:
+			fmt.Fprintf(&body, "%s := %s.%s(%s)\n", v, pkgName, rt.dec, in)
+		}
+		if rt.decErr {
+			fmt.Fprintf(&body, "if err != nil {\n%s\n}\n", onErr)
+		}
+	}
+	encode := func(out, v string) string {
+		call := fmt.Sprintf("%s.%s(%s)", pkgName, rt.enc, v)
+		if rt.method {
+			call = fmt.Sprintf("%s.%s()", v, rt.enc)
+		}
+		if rt.encErr {
+			return out + ", err := " + call
+		}
+		return out + " := " + call
+	}
+
+	decode("v1", "data", "return")
+	fmt.Fprintln(&body, encode("enc", "v1"))
+	if rt.encErr {
+		declared = true
+		fmt.Fprintln(&body, `if err != nil {`)
+		body.WriteString(`t.Fatalf("could not encode %#v: %v", v1, err)` + "\n")
+		fmt.Fprintln(&body, `}`)
+	}
+	decode("v2", convert("enc", rt.encoded), `t.Fatalf("could not decode the encoding of %#v: %v", v1, err)`)
+	fmt.Fprintln(&body, `if !reflect.DeepEqual(v1, v2) {`)
+	body.WriteString(`t.Fatalf("the round trip changed the value:\nbefore: %#v\nafter:  %#v", v1, v2)` + "\n")
+	fmt.Fprintln(&body, `}`)
+
+	var src strings.Builder
+	fmt.Fprintln(&src, "// Code generated by gofuzz gen-roundtrip.")
+	fmt.Fprintln(&src)
+	fmt.Fprintf(&src, "package %s_test\n\n", pkg.Name())
+	paths := make([]string, 0, len(imports))
+	for p := range imports {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	fmt.Fprintln(&src, "import (")
+	// standard library imports come first, in a group of their own
+	for _, std := range []bool{true, false} {
+		if !std {
+			fmt.Fprintln(&src)
+		}
+		for _, p := range paths {
+			if isStdImport(p) != std {
+				continue
+			}
+			if path.Base(p) == imports[p] {
+				fmt.Fprintf(&src, "%q\n", p)
+			} else {
+				fmt.Fprintf(&src, "%s %q\n", imports[p], p)
+			}
+		}
+	}
+	fmt.Fprintln(&src, ")")
+	fmt.Fprintln(&src)
+	fmt.Fprintf(&src, "// %s checks that decoding, encoding and decoding again preserves the value\n", rt.name)
+	fmt.Fprintf(&src, "func %s(f *testing.F) {\n", rt.name)
+	// seed the corpus with the encoding of the zero value
+	fmt.Fprintf(&src, "var zero %s\n", typ)
+	if rt.encErr {
+		fmt.Fprintf(&src, "if %s; err == nil {\n", encode("seed", "zero"))
+		fmt.Fprintf(&src, "f.Add(%s)\n}\n", convert("seed", rt.encoded))
+	} else {
+		fmt.Fprintf(&src, "%s\n", encode("seed", "zero"))
+		fmt.Fprintf(&src, "f.Add(%s)\n", convert("seed", rt.encoded))
+	}
+	fmt.Fprintf(&src, "f.Fuzz(func(t *testing.T, data %s) {\n", data)
+	src.WriteString(body.String())
+	fmt.Fprintln(&src, "})")
+	fmt.Fprintln(&src, "}")
+	return src.String()
+}
+
+// genRoundTripCmd implements the gen-roundtrip subcommand
+func genRoundTripCmd(args []string) {
+	flags := flag.NewFlagSet("gen-roundtrip", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, genRoundTripHelpText)
+		flags.PrintDefaults()
+	}
+	root := flags.String("root", ".", "root dir of the go project")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	err := os.Chdir(*root)
+	if err != nil {
+		die(err)
+	}
+	modPath := readModulePath(".")
+	if modPath == "" {
+		die("no module path found in go.mod.")
+	}
+	rel := path.Clean(strings.TrimPrefix(filepath.ToSlash(flags.Arg(0)), "./"))
+	dir := filepath.FromSlash(rel)
+	pkg, trips, err := findRoundTrips(dir, genFunc{dir: rel}.importPath(modPath))
+	if err != nil {
+		die(err)
+	}
+	if len(trips) == 0 {
+		die(fmt.Errorf(`no encode/decode pairs found in "%s"`, dir))
+	}
+	for _, rt := range trips {
+		p := filepath.Join(dir, strings.ToLower(rt.name)+"_test.go")
+		err := writeGenerated(p, roundTripTarget(pkg, rt))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "warning:", err)
+			continue
+		}
+		fmt.Printf("wrote %s\n", p)
+	}
+}
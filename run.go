@@ -0,0 +1,489 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// runner runs fuzz targets using the go test command
+type runner struct {
+	ctx context.Context
+	// goTest is the template of the go test command
+	goTest commandTemplate
+	// goTestArgs are the user-supplied GOTESTARGS
+	goTestArgs []string
+	// short makes go test run with -short
+	short bool
+	// runSeeds makes fuzzing runs also run the seed corpus as a regular test
+	runSeeds bool
+	// fuzzCache, if set, is used as the fuzz cache dir instead of the one in GOCACHE
+	fuzzCache string
+	// count and shuffle are the -count and -shuffle of the pre-check
+	count   int
+	shuffle string
+	// stream, if set, receives the output lines of the commands as they arrive
+	stream lineSink
+	// cpuBudget, if set, is the cpu time after which fuzzing is stopped
+	cpuBudget time.Duration
+	// plateau, if set, is how long fuzzing may go on without finding new interesting inputs before it's stopped
+	plateau time.Duration
+	// testJSON makes go test write its output as a stream of json events,
+	// which tell about the run more precisely than the output
+	testJSON bool
+	// env are extra NAME=VALUE environment variables for all the commands
+	env []string
+	// coverDir, if set, is where the runs of the seed corpora write their coverage profiles,
+	// which cover the packages of coverPkg, if set, rather than the package of the target
+	coverDir string
+	coverPkg string
+	// replay makes targets only run their seed corpus, as a regular test, rather than fuzz
+	replay bool
+	// redactRgxs match the names of the variables whose values are redacted from the streamed lines,
+	// and secrets is the -scan-secrets policy for them, as the results get from sanitize
+	redactRgxs []*regexp.Regexp
+	secrets    string
+}
+
+// cpuPollInterval is how often the cpu time of a fuzzing run is checked against the cpu budget,
+// and its progress against the plateau
+const cpuPollInterval = time.Second
+
+// lineSink receives the output lines of commands, prefixed with the path of their target
+type lineSink interface {
+	writeLine(prefix string, line []byte)
+}
+
+// lineWriter writes lines to w one at a time,
+// so that the lines of concurrent commands don't get mixed up
+type lineWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+	// timestamps makes each line begin with the time it arrived at
+	timestamps bool
+}
+
+// timestampFormat is the format of the timestamps of streamed lines
+const timestampFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// writeLine writes a line prefixed with prefix
+func (l *lineWriter) writeLine(prefix string, line []byte) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.timestamps {
+		fmt.Fprintf(l.w, "%s %s: %s\n", time.Now().Format(timestampFormat), prefix, line)
+		return
+	}
+	fmt.Fprintf(l.w, "%s: %s\n", prefix, line)
+}
+
+// prefixedStream passes the complete lines written to it to a lineSink,
+// with the secrets that scrubber finds removed
+type prefixedStream struct {
+	out      lineSink
+	prefix   string
+	buf      []byte
+	scrubber *lineScrubber
+}
+
+func (s *prefixedStream) Write(p []byte) (int, error) {
+	s.buf = append(s.buf, p...)
+	for {
+		i := bytes.IndexByte(s.buf, '\n')
+		if i < 0 {
+			break
+		}
+		s.out.writeLine(s.prefix, s.scrubber.scrub(s.buf[:i]))
+		s.buf = s.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// flush writes what's left of an unterminated last line
+func (s *prefixedStream) flush() {
+	if len(s.buf) > 0 {
+		s.out.writeLine(s.prefix, s.scrubber.scrub(s.buf))
+		s.buf = nil
+	}
+}
+
+// command returns the command that runs f.
+// if fuzzing is false, only the seed corpus of f is run.
+// the target's own args are appended after GOTESTARGS, and extra args after those,
+// so that they take precedence.
+func (r runner) command(f fuzz, fuzzing bool, extra ...string) (*exec.Cmd, error) {
+	run := fmt.Sprintf("-run=^%s$", f.fn)
+	if fuzzing && !r.runSeeds {
+		run = "-run=^$"
+	}
+	testArgs := []string{"./" + f.pkg, run}
+	if fuzzing {
+		testArgs = append(testArgs, fmt.Sprintf("-fuzz=^%s$", f.fn))
+	}
+	if r.short {
+		testArgs = append(testArgs, "-short")
+	}
+	if r.testJSON {
+		testArgs = append(testArgs, "-json")
+	}
+	testArgs = append(testArgs, r.goTestArgs...)
+	testArgs = append(testArgs, f.args...)
+	if fuzzing && r.fuzzCache != "" {
+		// go test passes its own -test.fuzzcachedir to the test binary,
+		// but the one given here comes later and takes precedence
+		dir := filepath.Join(r.fuzzCache, filepath.FromSlash(f.pkg))
+		testArgs = append(testArgs, "-test.fuzzcachedir="+dir)
+	}
+	testArgs = append(testArgs, extra...)
+	args, err := r.goTest.expand(commandData{
+		Args:   testArgs,
+		Pkg:    "./" + f.pkg,
+		Func:   f.fn,
+		Target: f.fullpath,
+	})
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.CommandContext(r.ctx, args[0], args[1:]...)
+	// the target's own variables come last, so that they take precedence
+	cmd.Env = append(append(os.Environ(), r.env...), f.env...)
+	cmd.WaitDelay = 10 * time.Second
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(syscall.SIGTERM)
+	}
+	return cmd, nil
+}
+
+// run fuzzes f and returns the result.
+// extra args are appended to the go test command.
+func (r runner) run(f fuzz, extra ...string) result {
+	if r.replay {
+		return r.replaySeeds(f, extra...)
+	}
+	res := r.exec(f, true, extra...)
+	if res.outcome != nil {
+		res.skipped = res.err == nil && (res.outcome.skipped || !res.outcome.fuzzed)
+	} else {
+		res.skipped = res.err == nil && notFuzzed(res.output)
+	}
+	return res
+}
+
+// replaySeeds runs the seed corpus of f, without fuzzing it, and returns the result.
+// go test only reports a skip with -v, or with -json, so a target that skipped
+// without either of them passes.
+func (r runner) replaySeeds(f fuzz, extra ...string) result {
+	res := r.exec(f, false, extra...)
+	if res.outcome != nil {
+		res.skipped = res.err == nil && res.outcome.skipped
+	} else {
+		res.skipped = res.err == nil && strings.Contains(res.output, "--- SKIP: "+f.fn+" ")
+	}
+	return res
+}
+
+var (
+	// failingInputRgx matches the line go test prints
+	// after writing a newly found failing input to the seed corpus
+	failingInputRgx = regexp.MustCompile(`Failing input written to (\S+)`)
+
+	// failingSeedRgx matches the line go test prints
+	// when an existing seed corpus entry fails
+	failingSeedRgx = regexp.MustCompile(`failure while testing seed corpus entry: (Fuzz\w+)/(\S+)`)
+
+	// hungRgx matches the line go test prints when a fuzzing worker stops responding,
+	// which usually means that an input made the target hang
+	hungRgx = regexp.MustCompile(`fuzzing process hung or terminated unexpectedly`)
+
+	// progressRgx matches fuzzing progress lines,
+	// capturing the number of executions or of seeds run so far
+	progressRgx = regexp.MustCompile(`^fuzz: elapsed: [^,]*, (execs: \d+|gathering baseline coverage: \d+/\d+)`)
+
+	// timedOutRgx matches the line go test prints when a test runs for longer than -timeout
+	timedOutRgx = regexp.MustCompile(`panic: test timed out after`)
+)
+
+// stalledLines is the number of progress lines in a row without any progress
+// after which a target is considered to hang
+const stalledLines = 5
+
+// hung reports whether the output of r shows that an input made the target hang,
+// either because go test reported it, or because fuzzing stopped making progress
+func (r result) hung() bool {
+	if hungRgx.MatchString(r.output) || timedOutRgx.MatchString(r.output) {
+		return true
+	}
+	stalled := 0
+	last := ""
+	for _, line := range strings.Split(r.output, "\n") {
+		m := progressRgx.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		if m[1] == last {
+			stalled++
+		} else {
+			stalled = 0
+		}
+		last = m[1]
+		if stalled >= stalledLines {
+			return true
+		}
+	}
+	return false
+}
+
+// failingInput returns the path of the input that made f fail,
+// as found in the output of its run, or an empty string if there is none
+func failingInput(f fuzz, output string) string {
+	if m := failingInputRgx.FindStringSubmatch(output); m != nil {
+		return path.Join(f.pkg, filepath.ToSlash(m[1]))
+	}
+	// seeds added with f.Add are named seed#N and have no file
+	if m := failingSeedRgx.FindStringSubmatch(output); m != nil && !strings.HasPrefix(m[2], "seed#") {
+		return path.Join(f.pkg, "testdata", "fuzz", m[1], m[2])
+	}
+	return ""
+}
+
+// notFuzzed reports whether the output of a passing fuzzing run
+// shows that the target skipped (e.g. because of a testing.Short guard)
+// rather than being fuzzed. go test only reports the skip with -v,
+// so a run that never reported any fuzzing progress is considered skipped too.
+func notFuzzed(output string) bool {
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, "--- SKIP: ") {
+			return true
+		}
+		if strings.HasPrefix(line, "fuzz: elapsed: ") {
+			return false
+		}
+	}
+	return true
+}
+
+// exec runs the command that runs f, and returns the result
+func (r runner) exec(f fuzz, fuzzing bool, extra ...string) result {
+	start := time.Now()
+	cmd, err := r.command(f, fuzzing, extra...)
+	if err != nil {
+		return result{fuzz: f, err: err, start: start}
+	}
+	logger.Debug("running target", "target", f.fullpath, "command", strings.Join(cmd.Args, " "))
+	var buf bytes.Buffer
+	var w io.Writer = &buf
+	var stream *prefixedStream
+	if r.stream != nil {
+		scrubber := &lineScrubber{redactor: newRedactor(r.redactRgxs, cmd.Env), policy: r.secrets}
+		stream = &prefixedStream{out: r.stream, prefix: f.fullpath, scrubber: scrubber}
+		w = io.MultiWriter(&buf, stream)
+	}
+	var watch *coverageWatch
+	if fuzzing && r.plateau > 0 {
+		watch = &coverageWatch{}
+		w = io.MultiWriter(w, watch)
+	}
+	var decoder *testJSONDecoder
+	if r.testJSON {
+		decoder = &testJSONDecoder{w: w, fn: f.fn}
+		w = decoder
+	}
+	cmd.Stdout, cmd.Stderr = w, w
+	if fuzzing && (r.cpuBudget > 0 || watch != nil) {
+		err = r.runWatched(f, cmd, watch)
+	} else {
+		err = cmd.Run()
+	}
+	if decoder != nil {
+		decoder.flush()
+	}
+	if stream != nil {
+		stream.flush()
+	}
+	res := result{
+		fuzz:     f,
+		output:   buf.String(),
+		err:      err,
+		env:      cmd.Env,
+		start:    start,
+		duration: time.Since(start),
+	}
+	if cmd.ProcessState != nil {
+		res.cpu = cmd.ProcessState.UserTime() + cmd.ProcessState.SystemTime()
+	}
+	if decoder != nil && decoder.events > 0 {
+		res.outcome = &decoder.outcome
+		// a target that doesn't build can't be fuzzed, so it's broken rather than failing
+		res.broken = res.outcome.buildFailed
+		if !res.outcome.started.IsZero() {
+			res.compile = max(res.outcome.started.Sub(start), 0)
+		}
+	}
+	if err != nil {
+		res.input = failingInput(f, res.output)
+	}
+	return res
+}
+
+// runWatched runs cmd, the command of f, and stops fuzzing once the command and its descendants
+// have used up the cpu budget, or once watch shows that fuzzing has plateaued.
+// fuzzing stops as it does when interrupted, so a target that hasn't failed by then passes.
+func (r runner) runWatched(f fuzz, cmd *exec.Cmd, watch *coverageWatch) error {
+	err := cmd.Start()
+	if err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(cpuPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			if watch != nil && watch.stalled(time.Now(), r.plateau) {
+				logger.Debug("stopping target, as it stopped finding new interesting inputs", "target", f.fullpath, "plateau", r.plateau)
+				interruptChildren(cmd.Process.Pid)
+				return
+			}
+			if r.cpuBudget <= 0 {
+				continue
+			}
+			used, err := treeCPUTime(cmd.Process.Pid)
+			if err == nil && used >= r.cpuBudget {
+				logger.Debug("stopping target, as it used up its cpu budget", "target", f.fullpath, "cpu-budget", r.cpuBudget)
+				interruptChildren(cmd.Process.Pid)
+				return
+			}
+		}
+	}()
+	err = cmd.Wait()
+	close(done)
+	return err
+}
+
+// coverageWatch follows the fuzzing progress lines written to it,
+// to tell when fuzzing stopped finding new interesting inputs
+type coverageWatch struct {
+	mu  sync.Mutex
+	buf []byte
+	// interesting is the last count of new interesting inputs,
+	// and grew is when it last grew, or when fuzzing began; it's zero before then
+	interesting int
+	grew        time.Time
+}
+
+func (c *coverageWatch) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.buf = append(c.buf, p...)
+	for {
+		i := bytes.IndexByte(c.buf, '\n')
+		if i < 0 {
+			break
+		}
+		line := c.buf[:i]
+		if m := fuzzStatsRgx.FindSubmatch(line); m != nil {
+			n, _ := strconv.Atoi(string(m[2]))
+			if c.grew.IsZero() || n > c.interesting {
+				c.interesting, c.grew = n, time.Now()
+			}
+		} else if c.grew.IsZero() && bytes.Contains(line, []byte("now fuzzing with")) {
+			// fuzzing begins once the baseline coverage is gathered
+			c.grew = time.Now()
+		}
+		c.buf = c.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// stalled reports whether fuzzing has found no new interesting inputs for the duration d
+func (c *coverageWatch) stalled(now time.Time, d time.Duration) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return !c.grew.IsZero() && now.Sub(c.grew) >= d
+}
+
+// trace runs the failing input of res again with the go execution tracer enabled,
+// writing the trace to the file at p. if go test didn't report the input,
+// the whole seed corpus is run instead, in case the input is one of the seeds.
+// the input likely hangs, so the run is stopped by go test after timeout;
+// the trace up to that point is kept.
+func (r runner) trace(res result, p string, timeout time.Duration) error {
+	run := fmt.Sprintf("-run=^%s$", res.fn)
+	if res.input != "" {
+		entry := regexp.QuoteMeta(path.Base(res.input))
+		run = fmt.Sprintf("-run=^%s$/^%s$", res.fn, entry)
+	}
+	out := r.exec(res.fuzz, false, run, "-trace="+p, "-timeout="+timeout.String())
+	if res.input == "" && !timedOutRgx.MatchString(out.output) {
+		os.Remove(p)
+		return fmt.Errorf("%s seems to hang, but go test did not report the input that causes it, and none of its seeds hang; no trace saved", res.fullpath)
+	}
+	_, err := os.Stat(p)
+	if err != nil {
+		return fmt.Errorf("could not trace %s: %w\n%s", res.fullpath, err, out.output)
+	}
+	return nil
+}
+
+// precheck verifies that f builds and that its seed corpus passes.
+// the seed corpus is run as a regular test rather than with -fuzztime=1x,
+// since the latter stops after the first seed entry.
+// with a count above 1, the seed corpus is run that many times,
+// and the target is broken if any of the iterations fails.
+func (r runner) precheck(f fuzz) result {
+	cover, err := r.coverArgs(f)
+	if err != nil {
+		logger.Warn("could not collect coverage", "target", f.fullpath, "err", err)
+	}
+	if r.count <= 1 && r.shuffle == "" {
+		res := r.exec(f, false, cover...)
+		res.broken = res.err != nil
+		if cover != nil {
+			logCoverage(f, res, r.coverprofile(f))
+		}
+		return res
+	}
+	args := []string{"-v", fmt.Sprintf("-count=%d", max(r.count, 1))}
+	if r.shuffle != "" {
+		args = append(args, "-shuffle="+r.shuffle)
+	}
+	res := r.exec(f, false, append(args, cover...)...)
+	res.broken = res.err != nil
+	if cover != nil {
+		logCoverage(f, res, r.coverprofile(f))
+	}
+	passed, failed := iterations(f, res.output)
+	if failed > 0 {
+		res.err = fmt.Errorf("seed corpus failed in %d of %d iterations", failed, passed+failed)
+	}
+	return res
+}
+
+// iterations counts the passing and failing iterations of f in the verbose output of go test
+func iterations(f fuzz, output string) (passed int, failed int) {
+	for _, line := range strings.Split(output, "\n") {
+		// subtests, such as the seed corpus entries, are indented
+		switch {
+		case strings.HasPrefix(line, "--- PASS: "+f.fn+" "):
+			passed++
+		case strings.HasPrefix(line, "--- FAIL: "+f.fn+" "):
+			failed++
+		}
+	}
+	return passed, failed
+}
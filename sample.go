@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sampleSpec is the parsed value of -sample,
+// which is either a number of targets or a percentage of them
+type sampleSpec struct {
+	n       int
+	percent float64
+}
+
+// parseSample parses a -sample value such as 10 or 10%
+func parseSample(s string) (sampleSpec, error) {
+	if p, ok := strings.CutSuffix(s, "%"); ok {
+		percent, err := strconv.ParseFloat(p, 64)
+		if err != nil || percent <= 0 || percent > 100 {
+			return sampleSpec{}, fmt.Errorf(`invalid percentage "%s"`, s)
+		}
+		return sampleSpec{percent: percent}, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n <= 0 {
+		return sampleSpec{}, fmt.Errorf(`invalid number of targets "%s"`, s)
+	}
+	return sampleSpec{n: n}, nil
+}
+
+// size returns the number of targets to sample out of total
+func (s sampleSpec) size(total int) int {
+	n := s.n
+	if s.percent > 0 {
+		n = int(float64(total)*s.percent/100 + 0.5)
+		if n == 0 {
+			n = 1
+		}
+	}
+	return min(n, total)
+}
+
+// collect receives every target from ch
+func collect(ch <-chan fuzz) []fuzz {
+	var targets []fuzz
+	for f := range ch {
+		targets = append(targets, f)
+	}
+	return targets
+}
+
+// stream returns a closed channel that yields targets
+func stream(targets []fuzz) <-chan fuzz {
+	ch := make(chan fuzz, len(targets))
+	for _, f := range targets {
+		ch <- f
+	}
+	close(ch)
+	return ch
+}
+
+// sampleTargets randomly selects a subset of targets.
+// the targets are sorted first, so that the same seed
+// selects the same subset regardless of discovery order.
+// weighed targets are selected with a probability that grows with their reach,
+// and are returned by the order of their reach.
+func sampleTargets(targets []fuzz, spec sampleSpec, seed int64) []fuzz {
+	sorted := make([]fuzz, len(targets))
+	copy(sorted, targets)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].fullpath < sorted[j].fullpath
+	})
+	rnd := rand.New(rand.NewSource(seed))
+	weighed := slices.ContainsFunc(sorted, func(f fuzz) bool { return f.reach > 0 })
+	if !weighed {
+		rnd.Shuffle(len(sorted), func(i, j int) {
+			sorted[i], sorted[j] = sorted[j], sorted[i]
+		})
+		return sorted[:spec.size(len(sorted))]
+	}
+	// weighted sampling without replacement, by the largest u^(1/w) of every target,
+	// where u is uniformly random and w is the weight of the target
+	keys := make(map[string]float64, len(sorted))
+	for _, f := range sorted {
+		keys[f.fullpath] = math.Pow(rnd.Float64(), 1/float64(f.reach+1))
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return keys[sorted[i].fullpath] > keys[sorted[j].fullpath]
+	})
+	picked := sorted[:spec.size(len(sorted))]
+	byReach(picked)
+	return picked
+}
+
+// cohortOf returns the cohort that the target at fullpath belongs to, out of k.
+// cohorts are assigned by hash, so adding targets doesn't reshuffle existing ones.
+func cohortOf(fullpath string, k int) int {
+	h := fnv.New32a()
+	h.Write([]byte(fullpath))
+	return int(h.Sum32() % uint32(k))
+}
+
+// rotateTargets splits targets into k cohorts, and returns the cohort
+// whose targets were fuzzed least recently according to recs.
+// running each selected cohort and recording its results in the stats DB
+// makes successive runs cycle through all cohorts,
+// so every target is fuzzed at least every k runs.
+func rotateTargets(targets []fuzz, k int, recs []statsRecord) ([]fuzz, int) {
+	cohorts := make([][]fuzz, k)
+	for _, f := range targets {
+		c := cohortOf(f.fullpath, k)
+		cohorts[c] = append(cohorts[c], f)
+	}
+	last := make([]time.Time, k)
+	for _, rec := range recs {
+		c := cohortOf(rec.Target, k)
+		if rec.Start.After(last[c]) {
+			last[c] = rec.Start
+		}
+	}
+	pick := -1
+	for c := range cohorts {
+		if len(cohorts[c]) == 0 {
+			continue
+		}
+		if pick < 0 || last[c].Before(last[pick]) {
+			pick = c
+		}
+	}
+	if pick < 0 {
+		return nil, 0
+	}
+	return cohorts[pick], pick
+}
+
+// distributeFuzztime gives each target a share of the total fuzzing time of a run, which has
+// parallel slots, as a -fuzztime that comes before its own args, so that a -fuzztime directive overrides it.
+// weighed targets get shares by their reach, but none more than the total, which is all the time there is.
+func distributeFuzztime(targets []fuzz, total time.Duration, parallel int) []fuzz {
+	if len(targets) == 0 {
+		return targets
+	}
+	weights := make([]float64, len(targets))
+	sum := 0.0
+	weighed := slices.ContainsFunc(targets, func(f fuzz) bool { return f.reach > 0 })
+	for i, f := range targets {
+		weights[i] = 1
+		if weighed {
+			weights[i] = float64(f.reach + 1)
+		}
+		sum += weights[i]
+	}
+	// the slots are shared by all targets, so they can fuzz for parallel times the total between them
+	slots := float64(total) * float64(min(max(parallel, 1), len(targets)))
+	out := make([]fuzz, len(targets))
+	for i, f := range targets {
+		share := time.Duration(slots * weights[i] / sum)
+		share = max(min(share, total).Round(time.Second), time.Second)
+		f.args = append([]string{"-fuzztime=" + share.String()}, f.args...)
+		logger.Debug("distributed fuzztime", "target", f.fullpath, "fuzztime", share)
+		out[i] = f
+	}
+	return out
+}
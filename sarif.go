@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sarifRuleID is the rule of the results of failed targets
+const sarifRuleID = "fuzz-failure"
+
+// stackFrameRgx matches the file and line of a frame of a go stack trace
+var stackFrameRgx = regexp.MustCompile(`^\s+(\S+\.go):(\d+)(\s|$)`)
+
+// sarifLog is the root object of a sarif report
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID     string            `json:"ruleId"`
+	Level      string            `json:"level"`
+	Message    sarifMessage      `json:"message"`
+	Locations  []sarifLocation   `json:"locations"`
+	Properties map[string]string `json:"properties,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI       string `json:"uri"`
+	URIBaseID string `json:"uriBaseId"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+// sarifReporter writes a sarif report at the end of the run,
+// with a result per failed target, for uploading to github code scanning
+type sarifReporter struct {
+	w       io.WriteCloser
+	results []sarifResult
+}
+
+func (s *sarifReporter) report(e event) error {
+	switch e.Type {
+	case eventTargetFinish:
+		if e.Status == "fail" {
+			s.results = append(s.results, sarifFailure(*e.result))
+		}
+	case eventRunEnd:
+		return s.write()
+	}
+	return nil
+}
+
+// sarifFailure returns the sarif result of the failed target r.
+// it's located at the innermost frame of the stack trace that is in the project,
+// or else at the test file of the target.
+func sarifFailure(r result) sarifResult {
+	msg := r.fullpath + " failed"
+	if reason := failureReason(r.output); reason != "" {
+		msg += ": " + reason
+	}
+	if r.input != "" {
+		msg += "\nfailing input: " + r.input
+	}
+	res := sarifResult{
+		RuleID:  sarifRuleID,
+		Level:   "error",
+		Message: sarifMessage{Text: msg},
+		Properties: map[string]string{
+			"target": r.fullpath,
+			"start":  r.start.Format(time.RFC3339Nano),
+			"end":    r.end().Format(time.RFC3339Nano),
+		},
+	}
+	if r.input != "" {
+		res.Properties["input"] = r.input
+	}
+	if stack := panicStack(r.output); stack != "" {
+		res.Properties["stack"] = stack
+	}
+	loc := sarifPhysicalLocation{
+		ArtifactLocation: sarifArtifactLocation{URI: r.file, URIBaseID: "%SRCROOT%"},
+	}
+	if file, line, ok := projectFrame(r.output); ok {
+		loc.ArtifactLocation.URI = file
+		loc.Region = &sarifRegion{StartLine: line}
+	}
+	res.Locations = []sarifLocation{{PhysicalLocation: loc}}
+	return res
+}
+
+// failureReason returns the panic message or the first error line in the output of a failed run
+func failureReason(output string) string {
+	for _, line := range strings.Split(output, "\n") {
+		if _, msg, ok := strings.Cut(line, "panic: "); ok {
+			return strings.TrimSpace(msg)
+		}
+	}
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "---") || strings.HasPrefix(line, "fuzz: ") {
+			continue
+		}
+		// errors of t.Error and friends, as in a_test.go:12: message
+		if i := strings.Index(line, ".go:"); i > 0 && !strings.ContainsAny(line[:i], " \t") {
+			return line
+		}
+	}
+	return ""
+}
+
+// panicStack returns the panic message and stack trace in the output of a failed run, if any
+func panicStack(output string) string {
+	var lines []string
+	for _, line := range strings.Split(output, "\n") {
+		if len(lines) == 0 && !strings.Contains(line, "panic: ") {
+			continue
+		}
+		trimmed := strings.TrimSpace(line)
+		if len(lines) > 0 && (trimmed == "" || strings.HasPrefix(trimmed, "FAIL") || strings.HasPrefix(trimmed, "exit status")) {
+			break
+		}
+		lines = append(lines, trimmed)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// projectFrame returns the file, relative to the current dir, and the line
+// of the first stack frame in the output that is under the current dir
+func projectFrame(output string) (string, int, bool) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", 0, false
+	}
+	for _, line := range strings.Split(output, "\n") {
+		m := stackFrameRgx.FindStringSubmatch(line)
+		if m == nil || !filepath.IsAbs(m[1]) {
+			continue
+		}
+		rel, err := filepath.Rel(wd, m[1])
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		n, err := strconv.Atoi(m[2])
+		if err != nil {
+			continue
+		}
+		return filepath.ToSlash(rel), n, true
+	}
+	return "", 0, false
+}
+
+// write writes the report
+func (s *sarifReporter) write() error {
+	log := sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs: []sarifRun{{
+			Tool: sarifTool{Driver: sarifDriver{
+				Name:           "gofuzz",
+				InformationURI: "https://github.com/koonix/gofuzz",
+				Rules: []sarifRule{{
+					ID:               sarifRuleID,
+					ShortDescription: sarifMessage{Text: "fuzz target failed"},
+				}},
+			}},
+			Results: s.results,
+		}},
+	}
+	if log.Runs[0].Results == nil {
+		log.Runs[0].Results = []sarifResult{}
+	}
+	enc := json.NewEncoder(s.w)
+	enc.SetIndent("", "  ")
+	err := enc.Encode(log)
+	if err != nil {
+		return fmt.Errorf("could not write sarif report: %w", err)
+	}
+	return nil
+}
+
+func (s *sarifReporter) close() error {
+	return s.w.Close()
+}
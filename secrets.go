@@ -0,0 +1,127 @@
+package main
+
+import (
+	"regexp"
+)
+
+// secret scanning policies
+const (
+	secretsOff    = "off"
+	secretsRedact = "redact"
+	secretsBlock  = "block"
+)
+
+// secretRgxs match common kinds of secrets.
+// fuzz inputs and test output may contain them by accident,
+// e.g. when seeds are taken from test fixtures.
+var secretRgxs = []*regexp.Regexp{
+	// private keys, up to their end, or else the end of the text
+	regexp.MustCompile(`(?s)-----BEGIN [A-Z ]*PRIVATE KEY-----.*?(?:-----END [A-Z ]*PRIVATE KEY-----|\z)`),
+	// AWS access key ids
+	regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`),
+	// GitHub tokens
+	regexp.MustCompile(`\b(gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`),
+	// GitLab tokens
+	regexp.MustCompile(`\bglpat-[A-Za-z0-9_-]{20,}\b`),
+	// Slack tokens
+	regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}\b`),
+	// Google API keys
+	regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`),
+	// Stripe keys
+	regexp.MustCompile(`\b[sr]k_(live|test)_[0-9A-Za-z]{16,}\b`),
+	// JSON web tokens
+	regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{8,}\.eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}`),
+}
+
+// redactSecrets returns s with anything that looks like a secret replaced,
+// and whether anything was found
+func redactSecrets(s string) (string, bool) {
+	return replaceSecrets(s, redactedText)
+}
+
+// replaceSecrets returns s with anything that looks like a secret replaced with text,
+// and whether anything was found
+func replaceSecrets(s string, text string) (string, bool) {
+	found := false
+	for _, rgx := range secretRgxs {
+		if !rgx.MatchString(s) {
+			continue
+		}
+		found = true
+		s = rgx.ReplaceAllLiteralString(s, text)
+	}
+	return s, found
+}
+
+// withheldText replaces the possible secrets that the block policy withholds
+const withheldText = "[WITHHELD: possible secret]"
+
+// scrub returns s with the values of the secret variables that red redacts removed,
+// and anything else that looks like a secret redacted or withheld according to policy.
+// it reports whether anything was withheld.
+func scrub(red *redactor, policy string, s string) (string, bool) {
+	s = red.redact(s)
+	switch policy {
+	case secretsRedact:
+		s, _ = redactSecrets(s)
+	case secretsBlock:
+		return replaceSecrets(s, withheldText)
+	}
+	return s, false
+}
+
+// privateKeyBeginRgx and privateKeyEndRgx match the lines that private keys begin and end with,
+// for scrubbing the lines in between when text is scrubbed line by line
+var (
+	privateKeyBeginRgx = regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----`)
+	privateKeyEndRgx   = regexp.MustCompile(`-----END [A-Z ]*PRIVATE KEY-----`)
+)
+
+// lineScrubber scrubs text line by line, as it's streamed
+type lineScrubber struct {
+	redactor *redactor
+	policy   string
+	// inKey is set between the lines that a private key begins and ends with
+	inKey bool
+}
+
+// scrub returns line scrubbed as scrub does, treating the lines of a private key as secrets too
+func (l *lineScrubber) scrub(line []byte) []byte {
+	if l.inKey {
+		l.inKey = !privateKeyEndRgx.Match(line)
+		if l.policy == secretsBlock {
+			return []byte(withheldText)
+		}
+		return []byte(redactedText)
+	}
+	s, _ := scrub(l.redactor, l.policy, string(line))
+	if l.policy != "" && l.policy != secretsOff && privateKeyBeginRgx.Match(line) && !privateKeyEndRgx.Match(line) {
+		l.inKey = true
+	}
+	return []byte(s)
+}
+
+// sanitize returns r with the values of the secret variables that red redacts removed
+// from its output and from the excerpt of its failure, and, according to the policy,
+// anything else that looks like a secret, so that none of the reports or artifacts made of r contain them.
+// the block policy withholds just the possible secrets, so that what reports tell from the output,
+// such as the throughput and the crashing frame, stays intact, and marks r as withheld.
+func (r result) sanitize(red *redactor, policy string) result {
+	clean := func(s string) string {
+		s, withheld := scrub(red, policy, s)
+		r.withheld = r.withheld || withheld
+		return s
+	}
+	x := r.excerpt()
+	if x != nil {
+		x.Reason = clean(x.Reason)
+		x.Fail = clean(x.Fail)
+		x.Input = clean(x.Input)
+	}
+	r.output = clean(r.output)
+	if r.withheld {
+		logger.Warn("withholding possible secrets in the output of the target from reports and artifacts", "target", r.fullpath)
+	}
+	r.failure, r.sanitized = x, true
+	return r
+}
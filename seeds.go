@@ -0,0 +1,108 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+)
+
+// seedTypes are the types of fuzzing args that literals are converted to in f.Add calls
+var seedTypes = map[string]bool{
+	"string": true, "byte": true, "rune": true, "bool": true,
+	"int": true, "int8": true, "int16": true, "int32": true, "int64": true,
+	"uint": true, "uint8": true, "uint16": true, "uint32": true, "uint64": true,
+	"float32": true, "float64": true,
+}
+
+// inlineSeed is a call of f.Add in a fuzz function
+type inlineSeed struct {
+	// Line is the line that the call is on
+	Line int `json:"line"`
+	// Values are the source of the args of the call,
+	// which are only known if every arg is a simple literal such as "abc", -1 or []byte("abc")
+	Values []string `json:"values,omitempty"`
+}
+
+// scanInlineSeeds sets the f.Add calls of the fuzz functions fns, which are in the test file at p.
+// a file that can't be parsed leaves the functions without seeds.
+func scanInlineSeeds(p string, fns []scannedFunc) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, p, nil, parser.SkipObjectResolution)
+	if err != nil {
+		return
+	}
+	decls := make(map[string]*ast.FuncDecl)
+	for _, decl := range file.Decls {
+		if fd, ok := decl.(*ast.FuncDecl); ok && fd.Recv == nil && fd.Body != nil {
+			decls[fd.Name.Name] = fd
+		}
+	}
+	for i := range fns {
+		fd := decls[fns[i].Fn]
+		if fd == nil || len(fd.Type.Params.List) == 0 || len(fd.Type.Params.List[0].Names) == 0 {
+			continue
+		}
+		f := fd.Type.Params.List[0].Names[0].Name
+		ast.Inspect(fd.Body, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			sel, ok := call.Fun.(*ast.SelectorExpr)
+			if !ok || sel.Sel.Name != "Add" {
+				return true
+			}
+			if x, ok := sel.X.(*ast.Ident); !ok || x.Name != f {
+				return true
+			}
+			seed := inlineSeed{Line: fset.Position(call.Pos()).Line}
+			for _, arg := range call.Args {
+				v, ok := literalSource(arg)
+				if !ok {
+					seed.Values = nil
+					break
+				}
+				seed.Values = append(seed.Values, v)
+			}
+			fns[i].Seeds = append(fns[i].Seeds, seed)
+			return true
+		})
+	}
+}
+
+// literalSource returns the source of expr if it's a simple literal:
+// a basic literal, possibly negated, true, false,
+// or a conversion of a string literal such as []byte("abc")
+func literalSource(expr ast.Expr) (string, bool) {
+	switch e := expr.(type) {
+	case *ast.BasicLit:
+		return e.Value, true
+	case *ast.Ident:
+		if e.Name == "true" || e.Name == "false" {
+			return e.Name, true
+		}
+	case *ast.UnaryExpr:
+		if lit, ok := e.X.(*ast.BasicLit); ok && e.Op == token.SUB {
+			return "-" + lit.Value, true
+		}
+	case *ast.CallExpr:
+		if len(e.Args) != 1 {
+			return "", false
+		}
+		lit, ok := e.Args[0].(*ast.BasicLit)
+		if !ok {
+			return "", false
+		}
+		switch fn := e.Fun.(type) {
+		case *ast.ArrayType:
+			if elt, ok := fn.Elt.(*ast.Ident); ok && fn.Len == nil && elt.Name == "byte" {
+				return "[]byte(" + lit.Value + ")", true
+			}
+		case *ast.Ident:
+			if seedTypes[fn.Name] {
+				return fn.Name + "(" + lit.Value + ")", true
+			}
+		}
+	}
+	return "", false
+}
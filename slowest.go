@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// targetTiming is how long a target took, as listed by -top
+type targetTiming struct {
+	path string
+	pkg  string
+	// wall is the time the target took, and compile the part of it spent building its test binary
+	wall    time.Duration
+	compile time.Duration
+}
+
+// printSlowest prints the slowest targets, and the packages that took the longest to compile,
+// which is how long the slowest build of a target of the package took
+func (c *consoleReporter) printSlowest() {
+	if c.top <= 0 || len(c.timings) == 0 {
+		return
+	}
+	timings := make([]targetTiming, len(c.timings))
+	copy(timings, c.timings)
+	sort.SliceStable(timings, func(i, j int) bool {
+		return timings[i].wall > timings[j].wall
+	})
+	header := fmt.Sprintf("===== slowest %d targets =====", min(c.top, len(timings)))
+	if c.color {
+		header = paint(header, colorBold)
+	}
+	fmt.Fprintln(c.w, header)
+	for _, t := range timings[:min(c.top, len(timings))] {
+		line := fmt.Sprintf("%s: %s", t.path, t.wall.Round(time.Millisecond))
+		if t.compile > 0 {
+			line += fmt.Sprintf(" (compile %s)", t.compile.Round(time.Millisecond))
+		}
+		fmt.Fprintln(c.w, line)
+	}
+	fmt.Fprintln(c.w)
+
+	compiles := make(map[string]time.Duration)
+	for _, t := range timings {
+		if t.compile > 0 {
+			compiles[t.pkg] = max(compiles[t.pkg], t.compile)
+		}
+	}
+	if len(compiles) == 0 {
+		return
+	}
+	pkgs := make([]string, 0, len(compiles))
+	for pkg := range compiles {
+		pkgs = append(pkgs, pkg)
+	}
+	sort.Slice(pkgs, func(i, j int) bool {
+		if compiles[pkgs[i]] != compiles[pkgs[j]] {
+			return compiles[pkgs[i]] > compiles[pkgs[j]]
+		}
+		return pkgs[i] < pkgs[j]
+	})
+	header = fmt.Sprintf("===== slowest-compiling %d packages =====", min(c.top, len(pkgs)))
+	if c.color {
+		header = paint(header, colorBold)
+	}
+	fmt.Fprintln(c.w, header)
+	for _, pkg := range pkgs[:min(c.top, len(pkgs))] {
+		fmt.Fprintf(c.w, "%s: %s\n", pkg, compiles[pkg].Round(time.Millisecond))
+	}
+	fmt.Fprintln(c.w)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// ways of splitting reports
+const (
+	splitByOwner         = "owner"
+	splitByPackagePrefix = "package-prefix"
+)
+
+// splitReporter writes a separate report per group of targets,
+// such as per owner, by creating a reporter of the same kind for every group.
+// the report of a group is named after it, as in report.team-x.xml for report.xml.
+type splitReporter struct {
+	kind string
+	// path is the absolute path of the unsplit report
+	path string
+	by   string
+	// start is the run-start event, which every group's report begins with
+	start  *event
+	groups map[string]*splitGroup
+	order  []string
+}
+
+// splitGroup is the report of a group of targets
+type splitGroup struct {
+	rep reporter
+	sum summary
+}
+
+// newSplitReporter returns a reporter that splits the report given by spec.
+// only reporters that write to a file can be split.
+func newSplitReporter(spec string, by string) (*splitReporter, error) {
+	kind, arg, _ := strings.Cut(spec, "=")
+	switch kind {
+	case "json", "junit":
+	default:
+		return nil, fmt.Errorf(`the %s reporter can't be split`, kind)
+	}
+	if arg == "" || arg == "-" || strings.HasPrefix(arg, "fd:") {
+		return nil, fmt.Errorf(`the %s reporter needs a file to be split, as in %s=FILE`, kind, kind)
+	}
+	// reports of groups are created after the working dir changes
+	p, err := filepath.Abs(arg)
+	if err != nil {
+		return nil, err
+	}
+	return &splitReporter{
+		kind:   kind,
+		path:   p,
+		by:     by,
+		groups: make(map[string]*splitGroup),
+	}, nil
+}
+
+// keys returns the groups that the target of e belongs to
+func (s *splitReporter) keys(e event) []string {
+	if s.by == splitByOwner {
+		if len(e.Owners) == 0 {
+			return []string{"unowned"}
+		}
+		return e.Owners
+	}
+	prefix, _, _ := strings.Cut(e.Pkg, "/")
+	if prefix == "." {
+		prefix = "root"
+	}
+	return []string{prefix}
+}
+
+// group returns the report of the given group, creating it if needed
+func (s *splitReporter) group(key string) (*splitGroup, error) {
+	if g, ok := s.groups[key]; ok {
+		return g, nil
+	}
+	ext := filepath.Ext(s.path)
+	name := strings.TrimPrefix(key, "@")
+	p := strings.TrimSuffix(s.path, ext) + "." + sanitizeName(name) + ext
+	rep, err := newReporter(s.kind + "=" + p)
+	if err != nil {
+		return nil, err
+	}
+	g := &splitGroup{rep: rep}
+	s.groups[key] = g
+	s.order = append(s.order, key)
+	if s.start != nil {
+		err = rep.report(*s.start)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+func (s *splitReporter) report(e event) error {
+	switch e.Type {
+	case eventRunStart:
+		s.start = &e
+		return nil
+	case eventRunEnd:
+		var first error
+		for _, key := range s.order {
+			g := s.groups[key]
+			sum := g.sum
+			sum.Success = sum.Failed == 0 && sum.Broken == 0 && e.Status != "cancelled"
+			ge := e
+			ge.Summary = &sum
+			err := g.rep.report(ge)
+			if err != nil && first == nil {
+				first = err
+			}
+		}
+		return first
+	}
+	for _, key := range s.keys(e) {
+		g, err := s.group(key)
+		if err != nil {
+			return err
+		}
+		if e.Type == eventTargetFinish {
+			g.sum.add(*e.result)
+		}
+		err = g.rep.report(e)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *splitReporter) close() error {
+	var first error
+	for _, key := range s.order {
+		err := s.groups[key].rep.close()
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const statsHelpText = `Usage: gofuzz stats merge [OPTIONS...] SRCDIR...
+       gofuzz stats import [OPTIONS...] LOGFILE...
+
+merge combines the stats DBs in SRCDIRs into the stats DB specified by -stats-dir.
+shards are matched by name; records already present are not duplicated.
+
+import backfills the stats DB specified by -stats-dir with the results
+found in LOGFILEs, which are saved outputs of gofuzz or go test -fuzz.
+
+Options:
+`
+
+// statsShardExt is the file extension of stats DB shard files
+const statsShardExt = ".jsonl"
+
+// statsRecord is a single entry of the stats DB, describing one fuzzing result
+type statsRecord struct {
+	Run      string        `json:"run"`
+	Host     string        `json:"host"`
+	Target   string        `json:"target"`
+	Start    time.Time     `json:"start"`
+	End      time.Time     `json:"end"`
+	Duration time.Duration `json:"duration"`
+	// CPU is the cpu time that the target used
+	CPU    time.Duration `json:"cpu,omitempty"`
+	Status string        `json:"status"`
+	// Note and Labels are the -note and -label of the run
+	Note   string            `json:"note,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// key uniquely identifies a record across shards
+func (r statsRecord) key() string {
+	return r.Run + "\x00" + r.Target + "\x00" + r.Start.UTC().Format(time.RFC3339Nano)
+}
+
+// statsDB is a directory of shard files.
+// every writer (a gofuzz run on some machine) appends to its own shard,
+// so any number of shards can be written concurrently without locking,
+// and any set of stats DBs can be merged by combining their shards.
+type statsDB struct {
+	dir string
+}
+
+// statsShard is a shard of a stats DB, written to by a single gofuzz run
+type statsShard struct {
+	run    string
+	host   string
+	note   string
+	labels map[string]string
+	mu     sync.Mutex
+	file   *os.File
+	enc    *json.Encoder
+}
+
+// hostname returns the name of this machine
+func hostname() string {
+	host, err := os.Hostname()
+	if err != nil {
+		return "unknown"
+	}
+	return host
+}
+
+// newRunID returns an id for the current run that is unique across machines
+func newRunID() string {
+	return fmt.Sprintf("%s-%s-%d",
+		time.Now().UTC().Format("20060102T150405Z"),
+		sanitizeName(hostname()),
+		os.Getpid(),
+	)
+}
+
+// sanitizeName replaces characters that are unsafe in file names
+func sanitizeName(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9',
+			r == '-', r == '_', r == '.':
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+// openShard creates the shard of the given run
+func (db statsDB) openShard(run string) (*statsShard, error) {
+	err := os.MkdirAll(db.dir, 0o755)
+	if err != nil {
+		return nil, fmt.Errorf(`could not create stats dir "%s": %w`, db.dir, err)
+	}
+	p := filepath.Join(db.dir, run+statsShardExt)
+	file, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf(`could not create stats shard "%s": %w`, p, err)
+	}
+	return &statsShard{
+		run:  run,
+		host: hostname(),
+		file: file,
+		enc:  json.NewEncoder(file),
+	}, nil
+}
+
+// write appends a record to the shard, stamped with the shard's run, host, note and labels
+func (s *statsShard) write(rec statsRecord) error {
+	rec.Run = s.run
+	rec.Host = s.host
+	rec.Note = s.note
+	rec.Labels = s.labels
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.enc.Encode(rec)
+	if err != nil {
+		return fmt.Errorf(`could not write to stats shard "%s": %w`, s.file.Name(), err)
+	}
+	return nil
+}
+
+// close closes the shard
+func (s *statsShard) close() error {
+	return s.file.Close()
+}
+
+// shards returns the names of the shard files in the stats DB
+func (db statsDB) shards() ([]string, error) {
+	entries, err := os.ReadDir(db.dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf(`could not read stats dir "%s": %w`, db.dir, err)
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), statsShardExt) {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+// readShard reads all records of a shard file
+func readShard(p string) ([]statsRecord, error) {
+	file, err := os.Open(p)
+	if err != nil {
+		return nil, fmt.Errorf(`could not open stats shard "%s": %w`, p, err)
+	}
+	defer file.Close()
+	var recs []statsRecord
+	sc := bufio.NewScanner(file)
+	sc.Buffer(nil, 1024*1024)
+	for sc.Scan() {
+		line := sc.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var rec statsRecord
+		err := json.Unmarshal(line, &rec)
+		if err != nil {
+			return nil, fmt.Errorf(`invalid record in stats shard "%s": %w`, p, err)
+		}
+		recs = append(recs, rec)
+	}
+	err = sc.Err()
+	if err != nil {
+		return nil, fmt.Errorf(`could not scan stats shard "%s": %w`, p, err)
+	}
+	return recs, nil
+}
+
+// records returns all records in the stats DB, ordered by start time
+func (db statsDB) records() ([]statsRecord, error) {
+	names, err := db.shards()
+	if err != nil {
+		return nil, err
+	}
+	var all []statsRecord
+	for _, name := range names {
+		recs, err := readShard(filepath.Join(db.dir, name))
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, recs...)
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].Start.Before(all[j].Start)
+	})
+	return all, nil
+}
+
+// merge adds the records of the src stats DB into db.
+// records are merged per shard, and records already present are skipped,
+// so merging the same stats DB multiple times is harmless.
+func (db statsDB) merge(src statsDB) (int, error) {
+	names, err := src.shards()
+	if err != nil {
+		return 0, err
+	}
+	err = os.MkdirAll(db.dir, 0o755)
+	if err != nil {
+		return 0, fmt.Errorf(`could not create stats dir "%s": %w`, db.dir, err)
+	}
+	added := 0
+	for _, name := range names {
+		srcRecs, err := readShard(filepath.Join(src.dir, name))
+		if err != nil {
+			return added, err
+		}
+		p := filepath.Join(db.dir, name)
+		seen := make(map[string]bool)
+		dstRecs, err := readShard(p)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return added, err
+		}
+		for _, rec := range dstRecs {
+			seen[rec.key()] = true
+		}
+		file, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return added, fmt.Errorf(`could not open stats shard "%s": %w`, p, err)
+		}
+		enc := json.NewEncoder(file)
+		for _, rec := range srcRecs {
+			if seen[rec.key()] {
+				continue
+			}
+			seen[rec.key()] = true
+			err = enc.Encode(rec)
+			if err != nil {
+				file.Close()
+				return added, fmt.Errorf(`could not write to stats shard "%s": %w`, p, err)
+			}
+			added++
+		}
+		err = file.Close()
+		if err != nil {
+			return added, fmt.Errorf(`could not close stats shard "%s": %w`, p, err)
+		}
+	}
+	return added, nil
+}
+
+// statsCmd implements the stats subcommand
+func statsCmd(args []string) {
+	flags := flag.NewFlagSet("stats", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, statsHelpText)
+		flags.PrintDefaults()
+	}
+	statsDir := flags.String("stats-dir", "", "stats DB to operate on")
+	root := flags.String("root", ".", "root dir of the go project, used to resolve package paths in imported logs")
+	fn := flags.String("fn", "", "fuzz function name to assume for imported results that don't mention one")
+	if len(args) == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	sub := args[0]
+	flags.Parse(args[1:])
+	if *statsDir == "" {
+		die("-stats-dir is required.")
+	}
+	db := statsDB{dir: *statsDir}
+	switch sub {
+	case "merge":
+		if flags.NArg() == 0 {
+			die("no source stats dirs given.")
+		}
+		for _, src := range flags.Args() {
+			n, err := db.merge(statsDB{dir: src})
+			if err != nil {
+				die(fmt.Errorf(`could not merge "%s": %w`, src, err))
+			}
+			fmt.Printf("merged %d records from %s\n", n, src)
+		}
+	case "import":
+		if flags.NArg() == 0 {
+			die("no log files given.")
+		}
+		modPath := readModulePath(*root)
+		for _, p := range flags.Args() {
+			n, err := importLog(db, p, modPath, *fn)
+			if err != nil {
+				die(fmt.Errorf(`could not import "%s": %w`, p, err))
+			}
+			fmt.Printf("imported %d records from %s\n", n, p)
+		}
+	default:
+		flags.Usage()
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// tableRow is a target in the summary table printed at the end of a run
+type tableRow struct {
+	path     string
+	status   string
+	duration time.Duration
+	// interesting is the number of new interesting inputs that fuzzing found
+	interesting int
+	// crashers is the number of new failing inputs that fuzzing found
+	crashers int
+	// reason, input and signature are those of the failure of the target, if it failed
+	reason    string
+	input     string
+	signature string
+}
+
+// newTableRow returns the summary table row of r
+func newTableRow(r result) tableRow {
+	row := tableRow{
+		path:     r.fullpath,
+		status:   r.status(),
+		duration: r.duration,
+		crashers: len(failingInputRgx.FindAllString(r.output, -1)),
+	}
+	if row.status == "fail" {
+		row.reason = failureReason(r.output)
+		row.input = r.input
+		row.signature = failureSignature(r.output)
+	}
+	for _, line := range strings.Split(r.output, "\n") {
+		if m := fuzzStatsRgx.FindStringSubmatch(line); m != nil {
+			row.interesting, _ = strconv.Atoi(m[2])
+		}
+	}
+	return row
+}
+
+// statusRank orders the statuses of the summary table, so that the targets that need attention come first
+var statusRank = map[string]int{"fail": 0, "broken": 1, "cancelled": 2, "skip": 3, "pass": 4}
+
+// printTable prints the summary table of the targets and the totals of the run,
+// in the -report-format of the console. csv and markdown tables are followed by a table of the findings,
+// since their rows can't be followed by the output blocks of the failures, as in text.
+func (c *consoleReporter) printTable(s *summary) {
+	if len(c.rows) == 0 {
+		return
+	}
+	sort.SliceStable(c.rows, func(i, j int) bool {
+		a, b := c.rows[i], c.rows[j]
+		if statusRank[a.status] != statusRank[b.status] {
+			return statusRank[a.status] < statusRank[b.status]
+		}
+		return a.path < b.path
+	})
+	interesting, crashers := 0, 0
+	cells := [][]string{{"target", "status", "time", "new interesting", "crashers"}}
+	findings := [][]string{{"target", "reason", "failing input", "signature"}}
+	for _, row := range c.rows {
+		cells = append(cells, []string{
+			row.path, row.status, row.duration.Round(time.Millisecond).String(),
+			strconv.Itoa(row.interesting), strconv.Itoa(row.crashers),
+		})
+		if row.status == "fail" {
+			findings = append(findings, []string{row.path, row.reason, row.input, row.signature})
+		}
+		interesting += row.interesting
+		crashers += row.crashers
+	}
+	var totals string
+	if s != nil {
+		totals = fmt.Sprintf("%d targets: %d passed, %d failed, %d broken, %d skipped, %d cancelled; %d new interesting inputs, %d crashers",
+			s.Total, s.Passed, s.Failed, s.Broken, s.Skipped, s.Cancelled, interesting, crashers)
+	}
+	switch c.format {
+	case "csv":
+		w := csv.NewWriter(c.w)
+		w.WriteAll(cells)
+		if len(findings) > 1 {
+			fmt.Fprintln(c.w)
+			w.WriteAll(findings)
+		}
+	case "markdown":
+		writeMarkdownTable(c.w, cells)
+		if len(findings) > 1 {
+			fmt.Fprintln(c.w, "### findings")
+			fmt.Fprintln(c.w)
+			writeMarkdownTable(c.w, findings)
+		}
+		if totals != "" {
+			fmt.Fprintln(c.w, totals)
+		}
+	default:
+		header := "===== summary ====="
+		if c.color {
+			header = paint(header, colorBold)
+		}
+		fmt.Fprintln(c.w, header)
+		var b strings.Builder
+		tw := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+		for _, row := range cells {
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+		tw.Flush()
+		// rows are colored as a whole, since the color codes would throw off the alignment of the columns
+		lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+		for i, line := range lines {
+			if c.color && i > 0 {
+				line = paint(line, statusColor(c.rows[i-1].status))
+			}
+			fmt.Fprintln(c.w, line)
+		}
+		fmt.Fprintln(c.w)
+		if totals != "" {
+			fmt.Fprintln(c.w, totals)
+		}
+	}
+}
+
+// writeMarkdownTable writes a markdown table whose first row is the header
+func writeMarkdownTable(w io.Writer, cells [][]string) {
+	for i, row := range cells {
+		escaped := make([]string, len(row))
+		for j, cell := range row {
+			escaped[j] = markdownEscape(cell)
+		}
+		fmt.Fprintf(w, "| %s |\n", strings.Join(escaped, " | "))
+		if i == 0 {
+			fmt.Fprintf(w, "|%s\n", strings.Repeat(" --- |", len(row)))
+		}
+	}
+	fmt.Fprintln(w)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// tapReporter writes test anything protocol output, with a test point per target.
+// failures come with a yaml diagnostics block, as in tap version 13.
+type tapReporter struct {
+	w io.WriteCloser
+	n int
+}
+
+func (t *tapReporter) report(e event) error {
+	switch e.Type {
+	case eventRunStart:
+		_, err := fmt.Fprintln(t.w, "TAP version 13")
+		return err
+	case eventTargetFinish:
+		t.n++
+		var err error
+		switch e.Status {
+		case "fail", "broken":
+			msg := "fuzzing failed"
+			if e.Status == "broken" {
+				msg = "pre-check failed"
+			}
+			_, err = fmt.Fprintf(t.w, "not ok %d - %s\n", t.n, e.Target)
+			if err == nil {
+				err = t.diagnostics(e, msg)
+			}
+		case "skip":
+			reason := "not fuzzed"
+			if e.Reason != "" {
+				reason = e.Reason
+			}
+			_, err = fmt.Fprintf(t.w, "ok %d - %s # SKIP %s\n", t.n, e.Target, reason)
+		case "cancelled":
+			_, err = fmt.Fprintf(t.w, "ok %d - %s # SKIP cancelled\n", t.n, e.Target)
+		default:
+			_, err = fmt.Fprintf(t.w, "ok %d - %s\n", t.n, e.Target)
+		}
+		return err
+	case eventRunEnd:
+		_, err := fmt.Fprintf(t.w, "1..%d\n", t.n)
+		if err == nil && e.Status == "cancelled" {
+			_, err = fmt.Fprintf(t.w, "# run cancelled (%s); results are partial\n", e.Error)
+		}
+		return err
+	}
+	return nil
+}
+
+// diagnostics writes the yaml diagnostics block of a failed test point
+func (t *tapReporter) diagnostics(e event, msg string) error {
+	var b strings.Builder
+	b.WriteString("  ---\n")
+	fmt.Fprintf(&b, "  message: %q\n", msg)
+	if e.Input != "" {
+		fmt.Fprintf(&b, "  input: %q\n", e.Input)
+	}
+	if e.Error != "" {
+		fmt.Fprintf(&b, "  error: %q\n", e.Error)
+	}
+	if e.Excerpt != nil && e.Excerpt.Reason != "" {
+		fmt.Fprintf(&b, "  reason: %q\n", e.Excerpt.Reason)
+	}
+	if e.Start != nil {
+		fmt.Fprintf(&b, "  start: %s\n", e.Start.Format(time.RFC3339Nano))
+		fmt.Fprintf(&b, "  end: %s\n", e.End.Format(time.RFC3339Nano))
+	}
+	fmt.Fprintf(&b, "  duration_ms: %d\n", e.Duration.Milliseconds())
+	if out := strings.TrimRight(e.Output, "\n"); out != "" {
+		b.WriteString("  output: |\n")
+		for _, line := range strings.Split(out, "\n") {
+			b.WriteString("    " + line + "\n")
+		}
+	}
+	b.WriteString("  ...\n")
+	_, err := io.WriteString(t.w, b.String())
+	return err
+}
+
+func (t *tapReporter) close() error {
+	return t.w.Close()
+}
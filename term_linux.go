@@ -0,0 +1,9 @@
+package main
+
+import "syscall"
+
+// the ioctls that get and set the mode of a terminal
+const (
+	ioctlGetTermios = syscall.TCGETS
+	ioctlSetTermios = syscall.TCSETS
+)
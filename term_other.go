@@ -0,0 +1,15 @@
+//go:build !linux && !darwin
+
+package main
+
+import "errors"
+
+// makeRaw fails, as terminal modes aren't supported on this platform
+func makeRaw() (func(), error) {
+	return nil, errors.New("interactive terminals are not supported on this platform")
+}
+
+// termSize reports that the size of the terminal isn't known
+func termSize() (rows int, cols int, ok bool) {
+	return 0, 0, false
+}
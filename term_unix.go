@@ -0,0 +1,49 @@
+//go:build linux || darwin
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// ioctl performs the ioctl req on the file descriptor fd, with arg pointing at its data
+func ioctl(fd uintptr, req uintptr, arg unsafe.Pointer) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(arg))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// makeRaw puts the terminal on stdin in a mode where keys are read as they are pressed,
+// without being echoed, and returns a func that restores its previous mode.
+// signals such as that of ctrl-c still work.
+func makeRaw() (func(), error) {
+	fd := os.Stdin.Fd()
+	var old syscall.Termios
+	err := ioctl(fd, ioctlGetTermios, unsafe.Pointer(&old))
+	if err != nil {
+		return nil, err
+	}
+	raw := old
+	raw.Lflag &^= syscall.ICANON | syscall.ECHO
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+	err = ioctl(fd, ioctlSetTermios, unsafe.Pointer(&raw))
+	if err != nil {
+		return nil, err
+	}
+	return func() { ioctl(fd, ioctlSetTermios, unsafe.Pointer(&old)) }, nil
+}
+
+// termSize returns the number of rows and columns of the terminal on stdout
+func termSize() (rows int, cols int, ok bool) {
+	var ws struct{ Row, Col, Xpixel, Ypixel uint16 }
+	err := ioctl(os.Stdout.Fd(), syscall.TIOCGWINSZ, unsafe.Pointer(&ws))
+	if err != nil || ws.Row == 0 || ws.Col == 0 {
+		return 0, 0, false
+	}
+	return int(ws.Row), int(ws.Col), true
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"time"
+)
+
+// testEvent is an event of the stream that go test -json writes, as described in go doc test2json
+type testEvent struct {
+	Time   time.Time
+	Action string
+	// Test is the test that the event is about, if any
+	Test string
+	// Output is the output line of an output event, including its newline
+	Output string
+	// FailedBuild is the import path of the package whose build made the test binary fail to build, if any
+	FailedBuild string
+}
+
+// testOutcome is what the events of a go test -json run tell about the target that it ran
+type testOutcome struct {
+	// buildFailed is set if the package failed to build
+	buildFailed bool
+	// passed, failed and skipped are set by the result that go test reported for the fuzz function
+	passed  bool
+	failed  bool
+	skipped bool
+	// fuzzed is set once go test reported fuzzing progress
+	fuzzed bool
+	// started is when the test binary started running, after the package was built
+	started time.Time
+}
+
+// testJSONDecoder decodes the go test -json stream written to it, writing the output lines of the events to w
+// and recording what the events tell about the run of the fuzz function fn.
+// lines that aren't events, such as those of a command that doesn't support -json,
+// are written out as they are, so the output is what it would have been without -json.
+type testJSONDecoder struct {
+	w  io.Writer
+	fn string
+	// events is the number of events decoded
+	events  int
+	outcome testOutcome
+	buf     []byte
+}
+
+func (d *testJSONDecoder) Write(p []byte) (int, error) {
+	d.buf = append(d.buf, p...)
+	for {
+		i := bytes.IndexByte(d.buf, '\n')
+		if i < 0 {
+			break
+		}
+		err := d.decodeLine(d.buf[:i+1])
+		d.buf = d.buf[i+1:]
+		if err != nil {
+			return len(p), err
+		}
+	}
+	return len(p), nil
+}
+
+// flush decodes what's left of an unterminated last line
+func (d *testJSONDecoder) flush() error {
+	if len(d.buf) == 0 {
+		return nil
+	}
+	err := d.decodeLine(d.buf)
+	d.buf = nil
+	return err
+}
+
+// decodeLine handles a line of the stream
+func (d *testJSONDecoder) decodeLine(line []byte) error {
+	var e testEvent
+	if !bytes.HasPrefix(line, []byte("{")) || json.Unmarshal(line, &e) != nil || e.Action == "" {
+		_, err := d.w.Write(line)
+		return err
+	}
+	d.events++
+	if d.outcome.started.IsZero() && (e.Action == "start" || e.Action == "run") {
+		d.outcome.started = e.Time
+	}
+	switch {
+	case e.Action == "build-fail" || e.FailedBuild != "":
+		d.outcome.buildFailed = true
+	case e.Action == "output" && e.Test == "" && (strings.HasSuffix(strings.TrimSpace(e.Output), "[build failed]") ||
+		strings.HasSuffix(strings.TrimSpace(e.Output), "[setup failed]")):
+		// go versions before 1.24 only report the build failure in the output,
+		// and setup failures, such as of a missing package, are only reported there
+		d.outcome.buildFailed = true
+	case e.Test == d.fn && e.Action == "pass":
+		d.outcome.passed = true
+	case e.Test == d.fn && e.Action == "fail":
+		d.outcome.failed = true
+	case e.Test == d.fn && e.Action == "skip":
+		d.outcome.skipped = true
+	case e.Action == "output" && strings.HasPrefix(e.Output, "fuzz: elapsed: "):
+		d.outcome.fuzzed = true
+	}
+	if e.Output == "" {
+		return nil
+	}
+	_, err := io.WriteString(d.w, e.Output)
+	return err
+}
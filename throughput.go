@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// throughputRgx matches fuzzing progress lines,
+// capturing the time spent fuzzing and the executions so far
+var throughputRgx = regexp.MustCompile(`^fuzz: elapsed: ([^,]*), execs: (\d+) \(\d+/sec\)`)
+
+// throughput is how fast a target was fuzzed
+type throughput struct {
+	// execs is the number of executions of the fuzz function, over all the workers
+	execs int64
+	// elapsed is the time spent fuzzing, as reported by go test
+	elapsed time.Duration
+}
+
+// perSec returns the executions per second
+func (t throughput) perSec() float64 {
+	if t.elapsed <= 0 {
+		return 0
+	}
+	return float64(t.execs) / t.elapsed.Seconds()
+}
+
+// throughput returns how fast the target of r was fuzzed,
+// according to the last progress line in its output.
+// the executions of every worker are included, as go test counts them together.
+func (r result) throughput() (throughput, bool) {
+	var t throughput
+	found := false
+	for _, line := range strings.Split(r.output, "\n") {
+		m := throughputRgx.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		elapsed, err := time.ParseDuration(m[1])
+		if err != nil {
+			continue
+		}
+		execs, err := strconv.ParseInt(m[2], 10, 64)
+		if err != nil {
+			continue
+		}
+		t, found = throughput{execs: execs, elapsed: elapsed}, true
+	}
+	return t, found
+}
+
+// targetThroughput is the throughput of a target, as listed at the end of a run
+type targetThroughput struct {
+	path string
+	throughput
+}
+
+// printThroughput prints the throughput of the targets, the slowest first,
+// so that pathologically slow targets stand out, followed by the total of the run
+func (c *consoleReporter) printThroughput(elapsed time.Duration) {
+	if len(c.throughputs) == 0 {
+		return
+	}
+	sort.SliceStable(c.throughputs, func(i, j int) bool {
+		return c.throughputs[i].perSec() < c.throughputs[j].perSec()
+	})
+	var execs int64
+	for _, t := range c.throughputs {
+		execs += t.execs
+	}
+	header := "===== throughput (slowest first) ====="
+	if c.color {
+		header = paint(header, colorBold)
+	}
+	fmt.Fprintln(c.w, header)
+	if !c.quiet {
+		for _, t := range c.throughputs {
+			fmt.Fprintf(c.w, "%s: %.0f execs/sec (%d execs in %s)\n", t.path, t.perSec(), t.execs, t.elapsed)
+		}
+	}
+	total := throughput{execs: execs, elapsed: elapsed}
+	fmt.Fprintf(c.w, "total: %.0f execs/sec (%d execs in %s)\n\n", total.perSec(), execs, elapsed.Round(time.Second))
+}
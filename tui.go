@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tuiKeys is the help line of the table view of the dashboard
+const tuiKeys = "j/k: select  enter: view log  c: cancel target  ctrl-c: cancel run"
+
+// tuiLogLines is the number of output lines of each running target that the dashboard keeps
+const tuiLogLines = 1000
+
+// fuzzStatsRgx matches fuzzing progress lines,
+// capturing the executions per second and the inputs found to be interesting
+var fuzzStatsRgx = regexp.MustCompile(`^fuzz: elapsed: [^,]*, execs: \d+ \((\d+)/sec\), new interesting: (\d+)`)
+
+// liveTarget is a target that is running, as shown by the dashboard
+type liveTarget struct {
+	path        string
+	start       time.Time
+	execsPerSec int
+	interesting int
+	log         []string
+	cancel      context.CancelFunc
+}
+
+// dashboard is an interactive view of the running targets in the terminal,
+// which lets one view the live output of a target or cancel it.
+// it receives the events of the run as a reporter,
+// and the output lines of the targets as a lineSink.
+type dashboard struct {
+	mu       sync.Mutex
+	w        io.Writer
+	targets  *targetCount
+	running  map[string]*liveTarget
+	cancels  map[string]context.CancelFunc
+	finished int
+	failed   int
+	// selected is the index of the selected target in the table,
+	// and viewing is the path of the target whose log is shown, if any
+	selected int
+	viewing  string
+	restore  func()
+	done     chan struct{}
+	stopOnce sync.Once
+	// deferred holds what other reporters write to stdout while the dashboard is shown,
+	// which is written out once it's stopped
+	deferred bytes.Buffer
+}
+
+// newDashboard takes over the terminal and starts drawing the dashboard
+// of the targets counted by targets
+func newDashboard(targets *targetCount) (*dashboard, error) {
+	restore, err := makeRaw()
+	if err != nil {
+		return nil, fmt.Errorf("could not set up the terminal: %w", err)
+	}
+	d := &dashboard{
+		w:       os.Stdout,
+		targets: targets,
+		running: make(map[string]*liveTarget),
+		cancels: make(map[string]context.CancelFunc),
+		restore: restore,
+		done:    make(chan struct{}),
+	}
+	// draw on the alternate screen, so that the terminal is left as it was
+	fmt.Fprint(d.w, "\x1b[?1049h\x1b[?25l")
+	go d.readKeys()
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-d.done:
+				return
+			case <-ticker.C:
+				d.draw()
+			}
+		}
+	}()
+	return d, nil
+}
+
+// stop restores the terminal and writes out what was deferred
+func (d *dashboard) stop() {
+	d.stopOnce.Do(func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		close(d.done)
+		fmt.Fprint(d.w, "\x1b[?25h\x1b[?1049l")
+		d.restore()
+		d.w.Write(d.deferred.Bytes())
+	})
+}
+
+// deferredWriter returns a writer whose output is held back until the dashboard is stopped
+func (d *dashboard) deferredWriter() io.Writer {
+	return writerFunc(func(p []byte) (int, error) {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		select {
+		case <-d.done:
+			return d.w.Write(p)
+		default:
+			return d.deferred.Write(p)
+		}
+	})
+}
+
+// writerFunc is a func that implements io.Writer
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+// track registers the func that cancels the target f
+func (d *dashboard) track(f fuzz, cancel context.CancelFunc) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.cancels[f.fullpath] = cancel
+}
+
+func (d *dashboard) report(e event) error {
+	d.mu.Lock()
+	switch e.Type {
+	case eventTargetStart:
+		d.running[e.Target] = &liveTarget{path: e.Target, start: e.Time, cancel: d.cancels[e.Target]}
+	case eventTargetFinish:
+		delete(d.running, e.Target)
+		delete(d.cancels, e.Target)
+		d.finished++
+		if e.Status == "fail" || e.Status == "broken" {
+			d.failed++
+		}
+		if d.viewing == e.Target {
+			d.viewing = ""
+		}
+	}
+	d.mu.Unlock()
+	d.draw()
+	return nil
+}
+
+func (d *dashboard) close() error {
+	return nil
+}
+
+// writeLine records an output line of the target at prefix.
+// the lines come from the prefixedStream of the target, which has scrubbed them of secrets,
+// so the log pane shows no more than -stream would.
+func (d *dashboard) writeLine(prefix string, line []byte) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	t, ok := d.running[prefix]
+	if !ok {
+		return
+	}
+	s := string(line)
+	if m := fuzzStatsRgx.FindStringSubmatch(s); m != nil {
+		t.execsPerSec, _ = strconv.Atoi(m[1])
+		t.interesting, _ = strconv.Atoi(m[2])
+	}
+	t.log = append(t.log, s)
+	if len(t.log) > tuiLogLines {
+		t.log = t.log[len(t.log)-tuiLogLines:]
+	}
+}
+
+// sorted returns the running targets, by the order they started in
+func (d *dashboard) sorted() []*liveTarget {
+	targets := make([]*liveTarget, 0, len(d.running))
+	for _, t := range d.running {
+		targets = append(targets, t)
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		if !targets[i].start.Equal(targets[j].start) {
+			return targets[i].start.Before(targets[j].start)
+		}
+		return targets[i].path < targets[j].path
+	})
+	return targets
+}
+
+// readKeys handles the keys pressed until the dashboard is stopped
+func (d *dashboard) readKeys() {
+	buf := make([]byte, 16)
+	for {
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return
+		}
+		select {
+		case <-d.done:
+			return
+		default:
+		}
+		d.key(string(buf[:n]))
+		d.draw()
+	}
+}
+
+// key handles a pressed key
+func (d *dashboard) key(k string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.viewing != "" {
+		if k == "q" || k == "\x1b" || k == "h" {
+			d.viewing = ""
+		}
+		return
+	}
+	targets := d.sorted()
+	switch k {
+	case "k", "\x1b[A":
+		d.selected--
+	case "j", "\x1b[B":
+		d.selected++
+	}
+	d.selected = max(min(d.selected, len(targets)-1), 0)
+	if len(targets) == 0 {
+		return
+	}
+	t := targets[d.selected]
+	switch k {
+	case "\r", "\n", "l":
+		d.viewing = t.path
+	case "c":
+		if t.cancel != nil {
+			t.cancel()
+		}
+	}
+}
+
+// draw draws the dashboard
+func (d *dashboard) draw() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	select {
+	case <-d.done:
+		return
+	default:
+	}
+	rows, cols, ok := termSize()
+	if !ok {
+		rows, cols = 24, 80
+	}
+	var lines []string
+	if t, ok := d.running[d.viewing]; ok {
+		lines = append(lines, fmt.Sprintf("%s (running for %s)", t.path, time.Since(t.start).Round(time.Second)))
+		n := max(rows-3, 0)
+		lines = append(lines, t.log[max(len(t.log)-n, 0):]...)
+		for len(lines) < rows-1 {
+			lines = append(lines, "")
+		}
+		lines = append(lines, "q or esc: back")
+	} else {
+		// targets that broke or were cancelled before they started never ran
+		total, done := d.targets.get()
+		queued := strconv.Itoa(max(total-d.finished-len(d.running), 0))
+		if !done {
+			queued += "+"
+		}
+		// the target column takes what the other columns leave
+		width := max(cols-38, 20)
+		lines = append(lines,
+			fmt.Sprintf("gofuzz: %d running, %s queued, %d finished, %d failed", len(d.running), queued, d.finished, d.failed),
+			"",
+			fmt.Sprintf("  %-*s %10s %10s %12s", width, "target", "elapsed", "execs/s", "interesting"),
+		)
+		targets := d.sorted()
+		d.selected = max(min(d.selected, len(targets)-1), 0)
+		for i, t := range targets {
+			cursor := " "
+			if i == d.selected {
+				cursor = ">"
+			}
+			lines = append(lines, fmt.Sprintf("%s %-*s %10s %10d %12d",
+				cursor, width, t.path, time.Since(t.start).Round(time.Second), t.execsPerSec, t.interesting))
+		}
+		for len(lines) < rows-1 {
+			lines = append(lines, "")
+		}
+		lines = append(lines, tuiKeys)
+	}
+	if len(lines) > rows {
+		lines = lines[:rows]
+	}
+	var b strings.Builder
+	b.WriteString("\x1b[H")
+	for i, line := range lines {
+		if len(line) > cols {
+			line = line[:cols]
+		}
+		b.WriteString(line)
+		b.WriteString("\x1b[K")
+		if i < len(lines)-1 {
+			b.WriteString("\r\n")
+		}
+	}
+	io.WriteString(d.w, b.String())
+}